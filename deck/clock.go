@@ -0,0 +1,226 @@
+package deck
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Now is a wrapper for time.Now.
+var Now = func() time.Time { return mockClock.Now() }
+
+// Sleep is a wrapper for time.Sleep.
+var Sleep = func(d time.Duration) { mockClock.Sleep(d) }
+
+// After is a wrapper for time.After.
+var After = func(d time.Duration) <-chan time.Time { return mockClock.After(d) }
+
+// NewTicker is a wrapper for time.NewTicker.
+var NewTicker = func(d time.Duration) *Ticker { return mockClock.NewTicker(d) }
+
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) *Ticker
+}
+
+var mockClock clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
+
+// Ticker is a wrapper for time.Ticker, which can be driven by
+// a real or a fake clock.
+type Ticker struct {
+	// C is the channel on which ticks are delivered
+	C <-chan time.Time
+
+	stop func()
+}
+
+// Stop turns off the ticker. C is not closed.
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+// SetupClock mocks Now, Sleep, After and NewTicker with a Clock
+// frozen at now until TeardownClock is called.
+func SetupClock(now time.Time) *Clock {
+	own(mockNameClock)
+
+	c := NewClock(now)
+	mockClock = c
+
+	return c
+}
+
+// TeardownClock restores Now, Sleep, After and NewTicker to
+// the real ones.
+func TeardownClock() {
+	mockClock = realClock{}
+	disownAll(mockNameClock)
+}
+
+// SetupClock is like the package level SetupClock, but the real
+// clock is restored when the test ends instead of by
+// TeardownClock. It gets nil if another Deck owns the clock.
+func (d *Deck) SetupClock(now time.Time) *Clock {
+	d.t.Helper()
+
+	if !d.claim(mockNameClock, func() { mockClock = realClock{} }) {
+		return nil
+	}
+
+	c := NewClock(now)
+	mockClock = c
+
+	return c
+}
+
+// Clock is a fake clock which only moves when it is advanced.
+// Sleepers, timers of After and tickers waiting on the clock fire
+// in order of their deadlines when the clock passes them.
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	seq     int
+	waiters []*clockWaiter
+}
+
+type clockWaiter struct {
+	at     time.Time
+	seq    int
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewClock gets a Clock frozen at now. It can be injected into
+// code under test directly, e.g. in parallel tests.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now gets the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Sleep blocks until the clock is advanced by d.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After gets a channel which receives the time of the clock once
+// it is advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.wait(d, 0).ch
+}
+
+// NewTicker gets a Ticker which ticks every time the clock is
+// advanced by d. Like time.Ticker, ticks are dropped if they are
+// not received in time. It panics if d is not positive.
+func (c *Clock) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("deck: non-positive interval for NewTicker")
+	}
+
+	w := c.wait(d, d)
+
+	return &Ticker{C: w.ch, stop: func() { c.remove(w) }}
+}
+
+func (c *Clock) wait(d, period time.Duration) *clockWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	w := &clockWaiter{at: c.now.Add(d), seq: c.seq, period: period, ch: make(chan time.Time, 1)}
+
+	if d <= 0 && period == 0 {
+		w.ch <- c.now
+		return w
+	}
+
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+
+	return w
+}
+
+func (c *Clock) remove(w *clockWaiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// Advance moves the clock forward by d, and fires everything
+// waiting for deadlines passed in order. The clock is at the
+// deadline when each of them fires.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		sort.Slice(c.waiters, func(i, j int) bool {
+			wi, wj := c.waiters[i], c.waiters[j]
+			return wi.at.Before(wj.at) || (wi.at.Equal(wj.at) && wi.seq < wj.seq)
+		})
+
+		if len(c.waiters) == 0 || c.waiters[0].at.After(target) {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = w.at
+
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+
+	c.now = target
+	c.cond.Broadcast()
+}
+
+// BlockUntil blocks until at least n sleepers, timers of After
+// and tickers are waiting on the clock. It helps to advance the
+// clock only after code under test starts waiting in another
+// goroutine.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
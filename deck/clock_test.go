@@ -0,0 +1,100 @@
+package deck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Clock(t *testing.T) {
+	at := assert.New(t)
+
+	start := time.Date(2021, 3, 9, 4, 0, 0, 0, time.UTC)
+
+	t.Run("now", func(t *testing.T) {
+		c := SetupClock(start)
+		defer TeardownClock()
+
+		at.Equal(start, Now())
+		c.Advance(time.Hour)
+		at.Equal(start.Add(time.Hour), Now())
+	})
+
+	t.Run("sleep", func(t *testing.T) {
+		c := SetupClock(start)
+		defer TeardownClock()
+
+		done := make(chan time.Time)
+		go func() {
+			Sleep(time.Minute)
+			done <- Now()
+		}()
+
+		c.BlockUntil(1)
+		c.Advance(30 * time.Second)
+		select {
+		case <-done:
+			t.Fatal("woke up too early")
+		default:
+		}
+
+		c.Advance(time.Minute)
+		at.Equal(start.Add(90*time.Second), <-done)
+
+		Sleep(0)
+	})
+
+	t.Run("after and ticker", func(t *testing.T) {
+		c := SetupClock(start)
+		defer TeardownClock()
+
+		after := After(3 * time.Second)
+		ticker := NewTicker(time.Second)
+
+		c.Advance(time.Second)
+		at.Equal(start.Add(time.Second), <-ticker.C)
+
+		// ticks are dropped when they are not received.
+		c.Advance(5 * time.Second)
+		at.Equal(start.Add(2*time.Second), <-ticker.C)
+		at.Equal(start.Add(3*time.Second), <-after)
+
+		ticker.Stop()
+		c.Advance(time.Second)
+		select {
+		case <-ticker.C:
+			t.Fatal("stopped ticker ticked")
+		default:
+		}
+
+		at.Panics(func() { NewTicker(0) })
+	})
+
+	t.Run("real", func(t *testing.T) {
+		at.WithinDuration(time.Now(), Now(), time.Second)
+
+		Sleep(time.Millisecond)
+		<-After(time.Millisecond)
+
+		ticker := NewTicker(time.Millisecond)
+		<-ticker.C
+		ticker.Stop()
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		c := New(tb).SetupClock(start)
+		at.Equal(start, Now())
+		at.Equal(start, c.Now())
+
+		at.Panics(func() { SetupClock(start) })
+
+		other := &fakeTB{name: "other"}
+		at.Nil(New(other).SetupClock(start))
+		at.Equal("deck: Clock is already mocked by owner", other.fatal)
+
+		tb.cleanup()
+		at.WithinDuration(time.Now(), Now(), time.Second)
+	})
+}
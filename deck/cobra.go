@@ -0,0 +1,196 @@
+package deck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// CobraOptions is how ExecuteCobraCmd runs a cobra command.
+type CobraOptions struct {
+	// Args are args of the root command
+	Args []string
+	// Stdin is read by the command from InOrStdin
+	Stdin string
+	// Context is got by the command from Context, and it is
+	// context.Background if it is nil
+	Context context.Context
+}
+
+// CobraResult is how a cobra command run by ExecuteCobraCmd ended.
+type CobraResult struct {
+	// Stdout is the output to OutOrStdout
+	Stdout string
+	// Stderr is the output to ErrOrStderr
+	Stderr string
+	// Err is the error returned by the command
+	Err error
+	// Command is the subcommand resolved by args, or nil if
+	// args can not be resolved
+	Command *cobra.Command
+}
+
+// ExecuteCobraCmd executes a root cobra command with opts. Unlike
+// RunCobraCmd, subcommands are kept, stdout and stderr are
+// separated, and the resolved subcommand is reported. Since cobra
+// always executes a command tree from its root, with args relative
+// to the root, a subcommand gets an error instead of running.
+func ExecuteCobraCmd(root *cobra.Command, opts CobraOptions) CobraResult {
+	if root.HasParent() {
+		return CobraResult{Err: fmt.Errorf("deck: %q is not a root command", root.CommandPath())}
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetIn(strings.NewReader(opts.Stdin))
+
+	args := opts.Args
+	if args == nil {
+		args = []string{}
+	}
+	root.SetArgs(args)
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r := CobraResult{Err: root.ExecuteContext(ctx)}
+	r.Stdout, r.Stderr = stdout.String(), stderr.String()
+
+	// resolve the subcommand the same way as ExecuteC of cobra.
+	var err error
+	if root.TraverseChildren {
+		r.Command, _, err = root.Traverse(args)
+	} else {
+		r.Command, _, err = root.Find(args)
+	}
+	if err != nil {
+		r.Command = nil
+	}
+
+	return r
+}
+
+// CobraSnapshot gets a stable snapshot of a cobra command and all
+// of its subcommands, including hidden and deprecated ones. Every
+// command has its path, use line, aliases, help texts and flags
+// with shorthands, types, default values and usages, so breaking
+// changes of a CLI show up in a diff. The help command added by
+// cobra is left out. Help and version flags, which cobra adds when
+// a command executes, are shown without adding them to cmd, so the
+// snapshot is the same before and after cmd executes.
+func CobraSnapshot(cmd *cobra.Command) string {
+	var b strings.Builder
+	writeCobraSnapshot(&b, cmd)
+	return b.String()
+}
+
+// AssertCobraGolden asserts the snapshot of a cobra command got
+// by CobraSnapshot equals a golden file. See AssertGolden.
+func AssertCobraGolden(t *testing.T, name string, cmd *cobra.Command) bool {
+	t.Helper()
+	return assertGolden(t, name, CobraSnapshot(cmd), nil)
+}
+
+// AssertCobraGolden is like the package level AssertCobraGolden,
+// but failures are reported to the test of the Deck.
+func (d *Deck) AssertCobraGolden(name string, cmd *cobra.Command) bool {
+	d.t.Helper()
+	return assertGolden(d.t, name, CobraSnapshot(cmd), nil)
+}
+
+func writeCobraSnapshot(b *strings.Builder, cmd *cobra.Command) {
+	b.WriteString(cmd.CommandPath() + "\n")
+	writeCobraField(b, "use", cmd.Use)
+	if len(cmd.Aliases) > 0 {
+		writeCobraField(b, "aliases", strings.Join(cmd.Aliases, ", "))
+	}
+	writeCobraField(b, "short", cmd.Short)
+	writeCobraField(b, "long", cmd.Long)
+	writeCobraField(b, "example", cmd.Example)
+	writeCobraField(b, "deprecated", cmd.Deprecated)
+	if cmd.Hidden {
+		b.WriteString("  hidden: true\n")
+	}
+	writeCobraFlags(b, "persistent flags", cmd.PersistentFlags())
+	writeCobraFlags(b, "flags", cobraLocalFlags(cmd))
+	b.WriteString("\n")
+
+	for _, sub := range cmd.Commands() {
+		if !isCobraHelpCmd(sub) {
+			writeCobraSnapshot(b, sub)
+		}
+	}
+}
+
+// cobraLocalFlags gets local flags of cmd with help and version
+// flags added the same way as InitDefaultHelpFlag and
+// InitDefaultVersionFlag of cobra, but into a copy of the flags.
+func cobraLocalFlags(cmd *cobra.Command) *pflag.FlagSet {
+	flags := cmd.LocalNonPersistentFlags()
+
+	name := cmd.Name()
+	if name == "" {
+		name = "this command"
+	}
+
+	if cmd.Flags().Lookup("help") == nil {
+		flags.BoolP("help", "h", false, "help for "+name)
+	}
+
+	if cmd.Version != "" && cmd.Flags().Lookup("version") == nil {
+		if cmd.Flags().ShorthandLookup("v") == nil {
+			flags.BoolP("version", "v", false, "version for "+name)
+		} else {
+			flags.Bool("version", false, "version for "+name)
+		}
+	}
+
+	return flags
+}
+
+// isCobraHelpCmd reports whether cmd is the help command which
+// cobra adds to the root command when it executes.
+func isCobraHelpCmd(cmd *cobra.Command) bool {
+	root := cmd.Parent()
+	return root != nil && !root.HasParent() && cmd.Name() == "help" &&
+		cmd.Long == "Help provides help for any command in the application.\n"+
+			"Simply type "+root.Name()+" help [path to command] for full details."
+}
+
+func writeCobraField(b *strings.Builder, name, value string) {
+	if value != "" {
+		_, _ = fmt.Fprintf(b, "  %s: %q\n", name, value)
+	}
+}
+
+func writeCobraFlags(b *strings.Builder, title string, flags *pflag.FlagSet) {
+	if !flags.HasFlags() {
+		return
+	}
+
+	b.WriteString("  " + title + ":\n")
+	// flags are visited in lexicographical order.
+	flags.VisitAll(func(f *pflag.Flag) {
+		b.WriteString("    --" + f.Name)
+		if f.Shorthand != "" {
+			b.WriteString(", -" + f.Shorthand)
+		}
+		_, _ = fmt.Fprintf(b, " %s default=%q usage=%q", f.Value.Type(), f.DefValue, f.Usage)
+		if f.Hidden {
+			b.WriteString(" hidden")
+		}
+		if f.Deprecated != "" {
+			_, _ = fmt.Fprintf(b, " deprecated=%q", f.Deprecated)
+		}
+		b.WriteString("\n")
+	})
+}
@@ -0,0 +1,117 @@
+package deck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+func newTestCobraCmd() (root, create *cobra.Command) {
+	root = &cobra.Command{Use: "app", SilenceUsage: true}
+	user := &cobra.Command{Use: "user"}
+	create = &cobra.Command{
+		Use: "create",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, _ := ioutil.ReadAll(cmd.InOrStdin())
+			if len(name) == 0 {
+				return errors.New("name is required")
+			}
+			cmd.Printf(`{"name":%q,"tenant":%q}`, name, cmd.Context().Value(ctxKey{}))
+			_, _ = fmt.Fprint(cmd.ErrOrStderr(), "created")
+			return nil
+		},
+	}
+	user.AddCommand(create)
+	root.AddCommand(user)
+	return
+}
+
+func Test_Deck_Cobra_ExecuteCobraCmd(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("success", func(t *testing.T) {
+		root, create := newTestCobraCmd()
+
+		r := ExecuteCobraCmd(root, CobraOptions{
+			Args:    []string{"user", "create"},
+			Stdin:   "deck",
+			Context: context.WithValue(context.Background(), ctxKey{}, "dawn"),
+		})
+
+		at.Nil(r.Err)
+		at.Equal(`{"name":"deck","tenant":"dawn"}`, r.Stdout)
+		at.Equal("created", r.Stderr)
+		at.Equal(create, r.Command)
+		at.Equal("app user create", r.Command.CommandPath())
+		at.Equal(root, r.Command.Root())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		root, create := newTestCobraCmd()
+
+		r := ExecuteCobraCmd(root, CobraOptions{Args: []string{"user", "create"}})
+
+		at.Equal("name is required", r.Err.Error())
+		at.Equal("", r.Stdout)
+		at.Equal("Error: name is required\n", r.Stderr)
+		at.Equal(create, r.Command)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		root, _ := newTestCobraCmd()
+
+		r := ExecuteCobraCmd(root, CobraOptions{Args: []string{"post"}})
+
+		at.NotNil(r.Err)
+		at.Contains(r.Stderr, `unknown command "post" for "app"`)
+		at.Nil(r.Command)
+	})
+
+	t.Run("not root", func(t *testing.T) {
+		_, create := newTestCobraCmd()
+
+		r := ExecuteCobraCmd(create, CobraOptions{Args: []string{"--help"}})
+
+		at.Equal(`deck: "app user create" is not a root command`, r.Err.Error())
+		at.Equal("", r.Stdout)
+		at.Nil(r.Command)
+	})
+}
+
+func Test_Deck_Cobra_Snapshot(t *testing.T) {
+	at := assert.New(t)
+
+	root, create := newTestCobraCmd()
+	root.Version = "1.0.0"
+	root.PersistentFlags().StringP("config", "c", "", "config file")
+	create.Aliases = []string{"add", "new"}
+	create.Short = "Create a user"
+	create.Flags().Int("age", 18, "age of the user")
+	create.Flags().Bool("admin", false, "")
+	_ = create.Flags().MarkHidden("admin")
+	create.Flags().String("group", "", "")
+	_ = create.Flags().MarkDeprecated("group", "use --role instead")
+	root.AddCommand(&cobra.Command{Use: "debug", Hidden: true, Run: func(*cobra.Command, []string) {}})
+	root.AddCommand(&cobra.Command{Use: "plugins", Short: "Manage plugins"})
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	at.True(AssertCobraGolden(t, "cobra/app", root))
+
+	// snapshots do not add flags to commands.
+	at.Nil(root.Flags().Lookup("help"))
+	at.Nil(root.Flags().Lookup("version"))
+
+	// snapshots do not change after the command executes.
+	_ = ExecuteCobraCmd(root, CobraOptions{Args: []string{"help"}})
+	at.True(New(t).AssertCobraGolden("cobra/app", root))
+}
@@ -0,0 +1,328 @@
+package deck
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// commander fakes commands and owns their stubs and invocations.
+type commander struct {
+	mu           sync.Mutex
+	expectError  bool
+	expectStderr bool
+	stubs        []*Stub
+	transcript   *transcript
+	dir          string
+	calls        []fakeCall
+}
+
+type fakeCall struct {
+	name string
+	args []string
+	base string
+}
+
+// defaultCommander is used by SetupCmd and friends.
+var defaultCommander = &commander{}
+
+const errorCommand = "deck_exec_command_need_error"
+
+func (c *commander) setup(expectError, expectStderr bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expectError = expectError
+	c.expectStderr = expectStderr
+}
+
+func (c *commander) command(name string, args ...string) *exec.Cmd {
+	return c.fake(exec.Command, name, args)
+}
+
+func (c *commander) commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return c.fake(func(name string, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, name, args...)
+	}, name, args)
+}
+
+// fake gets a command created by newCmd which runs a helper
+// process instead of name.
+func (c *commander) fake(newCmd func(string, ...string) *exec.Cmd, name string, args []string) *exec.Cmd {
+	c.mu.Lock()
+	expectError, expectStderr := c.expectError, c.expectStderr
+	c.mu.Unlock()
+
+	if expectError {
+		return newCmd(errorCommand)
+	}
+
+	return newCmd(helperBinary(), c.resolve(name, args, expectStderr).build()...)
+}
+
+// resolve remembers a faked command and decides how its helper
+// process serves it.
+func (c *commander) resolve(name string, args []string, expectStderr bool) helperArgs {
+	h := helperArgs{
+		base:         c.newFakeCall(name, args),
+		expectStderr: expectStderr,
+		args:         append([]string{name}, args...),
+	}
+
+	if s := c.findStub(name, args); s != nil {
+		writeStub(s.snapshot(), h.base)
+		h.stub = true
+	} else if tr := c.replaying(); tr != nil {
+		if tr.recording {
+			h.record = true
+		} else {
+			c.mu.Lock()
+			spec := tr.spec(name, args)
+			c.mu.Unlock()
+
+			writeStub(spec, h.base)
+			h.stub = true
+		}
+	}
+
+	return h
+}
+
+// helperMarker follows "--" in args of a helper process. Args are
+// used instead of env because callers often replace cmd.Env.
+const helperMarker = "deck-helper-command"
+
+// helperArgs is what a helper process needs to know about the
+// faked command. It is passed as args of the process:
+//
+//	-test.run=TestHelperCommand -- deck-helper-command base opts name args...
+//
+// For shims, base is the address of the test process to resolve
+// the rest of helperArgs.
+type helperArgs struct {
+	base         string
+	stub         bool
+	record       bool
+	shim         bool
+	expectStderr bool
+	args         []string
+}
+
+func (h helperArgs) build() []string {
+	var opts []string
+	if h.stub {
+		opts = append(opts, "stub")
+	}
+	if h.record {
+		opts = append(opts, "record")
+	}
+	if h.shim {
+		opts = append(opts, "shim")
+	}
+	if h.expectStderr {
+		opts = append(opts, "stderr")
+	}
+
+	return append([]string{"-test.run=TestHelperCommand", "--",
+		helperMarker, h.base, strings.Join(opts, ",")}, h.args...)
+}
+
+// parseHelperArgs parses args of a helper process. It returns
+// false if the process is not started by a faked command.
+func parseHelperArgs(args []string) (h helperArgs, ok bool) {
+	for i, arg := range args {
+		if arg != "--" {
+			continue
+		}
+		if len(args) < i+4 || args[i+1] != helperMarker {
+			return
+		}
+
+		h.base = args[i+2]
+		for _, opt := range strings.Split(args[i+3], ",") {
+			switch opt {
+			case "stub":
+				h.stub = true
+			case "record":
+				h.record = true
+			case "shim":
+				h.shim = true
+			case "stderr":
+				h.expectStderr = true
+			}
+		}
+		h.args = args[i+4:]
+
+		return h, true
+	}
+
+	return
+}
+
+// helperBinary gets path of the test binary, which does not
+// depend on the working directory set by cmd.Dir.
+func helperBinary() string {
+	if bin, err := os.Executable(); err == nil {
+		return bin
+	}
+	return os.Args[0]
+}
+
+// isTestBinary reports whether the running binary is built by
+// go test, whose name ends with .test.
+func isTestBinary() bool {
+	bin := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	return strings.HasSuffix(bin, ".test")
+}
+
+// init serves helper processes of stubs, transcripts and shims.
+// Since they read files and dial addresses given by args, only
+// test binaries are served, never a program which imports deck.
+func init() {
+	if !isTestBinary() {
+		return
+	}
+
+	h, ok := parseHelperArgs(os.Args)
+	if !ok {
+		return
+	}
+
+	if h.shim {
+		var err error
+		if h, err = resolveShim(h); err != nil {
+			_, _ = Stderr.WriteString("deck: " + err.Error())
+			os.Exit(1)
+		}
+		os.Args = append([]string{os.Args[0]}, h.build()...)
+	}
+
+	switch {
+	case h.stub:
+		os.Exit(serveStub(h.base))
+	case h.record:
+		os.Exit(recordCommand(h))
+	}
+}
+
+func (c *commander) onCommand(name string, match ArgsMatcher) *Stub {
+	s := &Stub{name: name, match: match}
+
+	c.mu.Lock()
+	c.stubs = append(c.stubs, s)
+	c.mu.Unlock()
+
+	return s
+}
+
+func (c *commander) replaying() *transcript {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.transcript
+}
+
+func (c *commander) findStub(name string, args []string) *Stub {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.stubs {
+		if s.name == name && s.match(args) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// newFakeCall remembers a faked command and gets the base path
+// of files shared with its helper process.
+func (c *commander) newFakeCall(name string, args []string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if c.dir == "" {
+		if c.dir, err = ioutil.TempDir("", "deck-cmd"); err != nil {
+			panic(err)
+		}
+	}
+
+	base := filepath.Join(c.dir, strconv.Itoa(len(c.calls)+1))
+	c.calls = append(c.calls, fakeCall{name: name, args: args, base: base})
+
+	return base
+}
+
+func (c *commander) invocations() []Invocation {
+	c.mu.Lock()
+	calls := append([]fakeCall(nil), c.calls...)
+	c.mu.Unlock()
+
+	var (
+		invs   []Invocation
+		starts []int64
+	)
+	for _, fc := range calls {
+		b, err := ioutil.ReadFile(fc.base + ".json")
+		if err != nil {
+			continue
+		}
+
+		var r invocationRecord
+		if err = json.Unmarshal(b, &r); err != nil {
+			continue
+		}
+
+		stdin, _ := ioutil.ReadFile(fc.base + ".stdin")
+
+		invs = append(invs, Invocation{
+			Name:  fc.name,
+			Args:  fc.args,
+			Env:   r.Env,
+			Dir:   r.Dir,
+			Stdin: string(stdin),
+		})
+		starts = append(starts, r.Start)
+	}
+
+	sort.Stable(byStart{invs, starts})
+
+	return invs
+}
+
+type byStart struct {
+	invs   []Invocation
+	starts []int64
+}
+
+func (s byStart) Len() int           { return len(s.invs) }
+func (s byStart) Less(i, j int) bool { return s.starts[i] < s.starts[j] }
+func (s byStart) Swap(i, j int) {
+	s.invs[i], s.invs[j] = s.invs[j], s.invs[i]
+	s.starts[i], s.starts[j] = s.starts[j], s.starts[i]
+}
+
+// reset drops stubs and invocations and turns off
+// expectations of the commander.
+func (c *commander) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expectError = false
+	c.expectStderr = false
+	c.stubs = nil
+	c.transcript = nil
+	c.calls = nil
+	if c.dir != "" {
+		_ = os.RemoveAll(c.dir)
+		c.dir = ""
+	}
+}
@@ -0,0 +1,47 @@
+package deck
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Commander_HelperArgs(t *testing.T) {
+	at := assert.New(t)
+
+	h := helperArgs{base: "base", stub: true, expectStderr: true, args: []string{"git", "status"}}
+
+	parsed, ok := parseHelperArgs(append([]string{"deck.test"}, h.build()...))
+	at.True(ok)
+	at.Equal(h, parsed)
+
+	_, ok = parseHelperArgs([]string{"deck.test", "-test.v"})
+	at.False(ok)
+
+	_, ok = parseHelperArgs([]string{"deck.test", "--", "git", "status"})
+	at.False(ok)
+
+	_, ok = parseHelperArgs([]string{"deck.test", "--", helperMarker, "base"})
+	at.False(ok)
+}
+
+func Test_Deck_Commander_IsTestBinary(t *testing.T) {
+	at := assert.New(t)
+
+	at.True(isTestBinary())
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	for bin, ok := range map[string]bool{
+		"/tmp/go-build1/b001/deck.test": true,
+		"deck.test.exe":                 true,
+		"/usr/local/bin/app":            false,
+		"app.exe":                       false,
+		"test":                          false,
+	} {
+		os.Args = []string{bin}
+		at.Equal(ok, isTestBinary(), bin)
+	}
+}
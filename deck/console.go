@@ -0,0 +1,208 @@
+package deck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stdin is a wrapper for os.Stdin.
+var Stdin = os.Stdin
+
+// DefaultExpectTimeout is how long Expect of a Console waits
+// for its text by default.
+const DefaultExpectTimeout = 5 * time.Second
+
+// Console scripts interactive input of Stdin by what is printed
+// to Stdout, like expect does. Code under test usually runs in
+// another goroutine, since it blocks on reading Stdin.
+type Console struct {
+	// Timeout is how long Expect waits, DefaultExpectTimeout
+	// is used if it is zero
+	Timeout time.Duration
+
+	stdinR, stdin *os.File
+	stdout        *os.File
+
+	mu      sync.Mutex
+	out     []byte
+	pos     int
+	updated chan struct{}
+	done    chan struct{}
+}
+
+var defaultConsole *Console
+
+// SetupConsole mocks Stdin and Stdout with a Console until
+// TeardownConsole is called.
+func SetupConsole() *Console {
+	checkNotOwned(mockNameStdin)
+	checkNotOwned(mockNameStdout)
+
+	TeardownConsole()
+
+	own(mockNameStdin, mockNameStdout)
+	defaultConsole = newConsole()
+
+	return defaultConsole
+}
+
+// TeardownConsole closes the Console created by SetupConsole and
+// restores Stdin and Stdout. It gets everything printed to Stdout.
+func TeardownConsole() string {
+	if defaultConsole == nil {
+		return ""
+	}
+
+	out := defaultConsole.close()
+	defaultConsole = nil
+	disown(mockNameStdin, mockNameStdout)
+
+	return out
+}
+
+// SetupConsole is like the package level SetupConsole, but the
+// Console is closed and Stdin and Stdout are restored when the test
+// ends. Calling it again closes the previous Console.
+func (d *Deck) SetupConsole() *Console {
+	d.t.Helper()
+
+	var c *Console
+	restore := func() {
+		if c != nil {
+			_ = c.close()
+		}
+		if d.console == c {
+			d.console = nil
+		}
+	}
+
+	if !d.claim(mockNameStdin, restore) || !d.claim(mockNameStdout, nil) {
+		return nil
+	}
+
+	if d.console != nil {
+		_ = d.console.close()
+	}
+
+	c = newConsole()
+	d.console = c
+
+	return c
+}
+
+func newConsole() *Console {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	c := &Console{
+		stdinR:  inR,
+		stdin:   inW,
+		stdout:  outW,
+		updated: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go c.read(outR)
+
+	Stdin, Stdout = inR, outW
+
+	return c
+}
+
+func (c *Console) read(r io.ReadCloser) {
+	defer close(c.done)
+	defer func() { _ = r.Close() }()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			c.mu.Lock()
+			c.out = append(c.out, buf[:n]...)
+			close(c.updated)
+			c.updated = make(chan struct{})
+			c.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Expect waits until text is printed to Stdout after the text of
+// the last Expect. It returns an error with the unmatched output
+// if text is not printed before the timeout.
+func (c *Console) Expect(text string) error {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultExpectTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		if i := bytes.Index(c.out[c.pos:], []byte(text)); i >= 0 {
+			c.pos += i + len(text)
+			c.mu.Unlock()
+			return nil
+		}
+		updated, rest := c.updated, string(c.out[c.pos:])
+		c.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-c.done:
+			return fmt.Errorf("deck: %q is not printed before Stdout is closed, output:\n%s", text, rest)
+		case <-timer.C:
+			return fmt.Errorf("deck: %q is not printed in %s, output:\n%s", text, timeout, rest)
+		}
+	}
+}
+
+// Send writes s to Stdin.
+func (c *Console) Send(s string) error {
+	_, err := c.stdin.WriteString(s)
+	return err
+}
+
+// SendLine writes line and a newline to Stdin.
+func (c *Console) SendLine(line string) error {
+	return c.Send(line + "\n")
+}
+
+// CloseStdin closes Stdin, so reading it gets io.EOF.
+func (c *Console) CloseStdin() error {
+	return c.stdin.Close()
+}
+
+// Output gets everything printed to Stdout so far.
+func (c *Console) Output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return string(c.out)
+}
+
+func (c *Console) close() string {
+	_ = c.stdin.Close()
+	_ = c.stdout.Close()
+	<-c.done
+
+	Stdin, Stdout = os.Stdin, os.Stdout
+	_ = c.stdinR.Close()
+
+	return c.Output()
+}
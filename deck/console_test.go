@@ -0,0 +1,95 @@
+package deck
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wizard asks questions like an init command.
+func wizard() (answers []string, err error) {
+	r := bufio.NewReader(Stdin)
+	for _, q := range []string{"Project name: ", "Database (mysql/sqlite): ", "Confirm? [y/N] "} {
+		_, _ = fmt.Fprint(Stdout, q)
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return answers, err
+		}
+		answers = append(answers, strings.TrimSpace(line))
+	}
+	_, _ = fmt.Fprintln(Stdout, "created")
+
+	return answers, nil
+}
+
+func Test_Deck_Console(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("wizard", func(t *testing.T) {
+		c := SetupConsole()
+		defer TeardownConsole()
+
+		var answers []string
+		done := make(chan error)
+		go func() {
+			var err error
+			answers, err = wizard()
+			done <- err
+		}()
+
+		at.Nil(c.Expect("Project name: "))
+		at.Nil(c.SendLine("demo"))
+		at.Nil(c.Expect("Database"))
+		at.Nil(c.SendLine("sqlite"))
+		at.Nil(c.Expect("Confirm?"))
+		at.Nil(c.SendLine("y"))
+		at.Nil(c.Expect("created\n"))
+
+		at.Nil(<-done)
+		at.Equal([]string{"demo", "sqlite", "y"}, answers)
+		at.Equal("Project name: Database (mysql/sqlite): Confirm? [y/N] created\n", TeardownConsole())
+		at.Equal("", TeardownConsole())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := SetupConsole()
+		defer TeardownConsole()
+		c.Timeout = 50 * time.Millisecond
+
+		_, _ = fmt.Fprint(Stdout, "Name: ")
+
+		err := c.Expect("Password: ")
+		at.NotNil(err)
+		at.Contains(err.Error(), `"Password: " is not printed in 50ms, output:`)
+		at.Contains(err.Error(), "Name: ")
+	})
+
+	t.Run("eof", func(t *testing.T) {
+		c := SetupConsole()
+		defer TeardownConsole()
+
+		done := make(chan error)
+		go func() {
+			_, err := wizard()
+			done <- err
+		}()
+
+		at.Nil(c.Expect("Project name: "))
+		at.Nil(c.CloseStdin())
+		at.NotNil(<-done)
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		c := New(t).SetupConsole()
+
+		go func() { _, _ = wizard() }()
+
+		at.Nil(c.Expect("Project name: "))
+		at.Panics(func() { SetupConsole() })
+	})
+}
@@ -2,8 +2,9 @@ package deck
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
 
@@ -17,8 +18,12 @@ var mockOsExit = os.Exit
 // ExecCommand is a wrapper for exec.Command.
 var ExecCommand = func(name string, arg ...string) *exec.Cmd { return mockExecCommand(name, arg...) }
 var mockExecCommand = exec.Command
-var expectExecCommandError bool
-var expectExecCommandStderr bool
+
+// ExecCommandContext is a wrapper for exec.CommandContext.
+var ExecCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return mockExecCommandContext(ctx, name, arg...)
+}
+var mockExecCommandContext = exec.CommandContext
 
 // ExecLookPath is a wrapper for exec.LookPath.
 var ExecLookPath = func(file string) (string, error) { return mockExecLookPath(file) }
@@ -30,179 +35,367 @@ var ErrLookPath = errors.New("deck: look path error")
 
 // Stdout is a wrapper for os.Stdout.
 var Stdout = os.Stdout
-var stdoutForward *os.File
+var stdoutCapture *capture
 
 // Stderr is a wrapper for os.Stderr.
 var Stderr = os.Stderr
-var stderrForward *os.File
+var stderrCapture *capture
 
-// SetupCmd mocks ExecCommand. Must create one test function
+// SetupCmd mocks ExecCommand and ExecCommandContext. Must create one test function
 // named TestHelperCommand in a package and use HandleCommand
 // in it.
 func SetupCmd() {
-	mockExecCommand = fakeExecCommand
+	own(mockNameExecCommand)
+	defaultCommander.setup(false, false)
+	mockExecCommand = defaultCommander.command
+	mockExecCommandContext = defaultCommander.commandContext
 }
 
-// SetupErrorCmd mocks ExecCommand and when running the returned
+// SetupErrorCmd mocks ExecCommand and ExecCommandContext, and when running the returned
 // command, always get an error. Must create one test function
 // named TestHelperCommand in a package and use HandleCommand
 // in it.
 func SetupCmdError() {
-	mockExecCommand = fakeExecCommand
-	expectExecCommandError = true
+	own(mockNameExecCommand)
+	defaultCommander.setup(true, false)
+	mockExecCommand = defaultCommander.command
+	mockExecCommandContext = defaultCommander.commandContext
 }
 
-// SetupStderrCmd mocks ExecCommand. Must create one test function
+// SetupStderrCmd mocks ExecCommand and ExecCommandContext. Must create one test function
 // named TestHelperCommand in a package and use HandleCommand
 // in it. Besides, the second parameter of the handler function in
 // HandleCommand will be true.
 func SetupCmdStderr() {
-	mockExecCommand = fakeExecCommand
-	expectExecCommandStderr = true
+	own(mockNameExecCommand)
+	defaultCommander.setup(false, true)
+	mockExecCommand = defaultCommander.command
+	mockExecCommandContext = defaultCommander.commandContext
 }
 
-// TeardownCmd restores ExecCommand to the original one.
+// TeardownCmd restores ExecCommand and ExecCommandContext to
+// the original ones.
 func TeardownCmd() {
-	mockExecCommand = exec.Command
-	expectExecCommandError = false
-	expectExecCommandStderr = false
-}
-
-const errorCommand = "deck_exec_command_need_error"
+	err := defaultCommander.saveTranscript()
 
-func fakeExecCommand(command string, args ...string) (cmd *exec.Cmd) {
-	if expectExecCommandError {
-		return exec.Command(errorCommand)
-	}
-
-	args = append([]string{"-test.run=TestHelperCommand", "--", command}, args...)
-	cmd = exec.Command(os.Args[0], args...)
-	cmd.Env = []string{"GO_WANT_HELPER_COMMAND=1"}
+	mockExecCommand = exec.Command
+	mockExecCommandContext = exec.CommandContext
+	defaultCommander.reset()
+	disownAll(mockNameExecCommand)
 
-	if expectExecCommandStderr {
-		cmd.Env = append(cmd.Env, "GO_WANT_HELPER_EXPECT_STDERR=1")
+	if err != nil {
+		panic(err)
 	}
-
-	return cmd
 }
 
 // HandleCommand handles every command wanted help
 func HandleCommand(handler func(args []string, expectStderr bool)) {
-	if os.Getenv("GO_WANT_HELPER_COMMAND") != "1" {
+	HandleProcess(func(p *Process) int {
+		handler(p.Args, p.ExpectStderr)
+		return 0
+	})
+}
+
+// Process is a faked command running in a helper process.
+type Process struct {
+	// Args are the command name and arguments
+	Args []string
+	// Env is the environment set by the caller
+	Env []string
+	// Dir is the working directory set by the caller
+	Dir string
+	// Stdin reads what the caller writes to the command
+	Stdin io.Reader
+	// Stdout is stdout of the command
+	Stdout io.Writer
+	// Stderr is stderr of the command
+	Stderr io.Writer
+	// ExpectStderr is true when ExecCommand is mocked by SetupCmdStderr
+	ExpectStderr bool
+}
+
+// HandleProcess handles every command wanted help like
+// HandleCommand. The handler can read stdin of the command
+// and the returned code is used as its exit code.
+func HandleProcess(handler func(p *Process) int) {
+	h, ok := parseHelperArgs(os.Args)
+	if !ok {
 		return
 	}
-	args := os.Args
-	for len(args) > 0 {
-		if args[0] == "--" {
-			args = args[1:]
-			break
-		}
-		args = args[1:]
-	}
 
-	handler(args, os.Getenv("GO_WANT_HELPER_EXPECT_STDERR") == "1")
+	recordInvocation(h.base)
+	stdin := recordStdin(h.base)
+	dir, _ := os.Getwd()
+
+	code := handler(&Process{
+		Args:         h.args,
+		Env:          os.Environ(),
+		Dir:          dir,
+		Stdin:        stdin,
+		Stdout:       Stdout,
+		Stderr:       Stderr,
+		ExpectStderr: h.expectStderr,
+	})
 
-	OsExit(0)
+	stdin.wait()
+
+	OsExit(code)
 }
 
 // SetupExecLookPath mocks ExecLookPath.
 func SetupExecLookPath() {
-	mockExecLookPath = func(file string) (string, error) {
-		return file, nil
-	}
+	own(mockNameExecLookPath)
+	mockExecLookPath = lookPathAsIs
+}
+
+func lookPathAsIs(file string) (string, error) {
+	return file, nil
 }
 
 // SetupExecLookPathError mocks ExecLookPath and always return an error.
 func SetupExecLookPathError() {
-	mockExecLookPath = func(_ string) (string, error) {
+	own(mockNameExecLookPath)
+	mockExecLookPath = lookPathError
+}
+
+func lookPathError(_ string) (string, error) {
+	return "", ErrLookPath
+}
+
+// LookPath is a result of ExecLookPath for a file.
+type LookPath struct {
+	// Path is the found path, the file itself is used if it is empty
+	Path string
+	// Err is the error of looking up the file
+	Err error
+}
+
+// LookPaths maps files to results of ExecLookPath.
+type LookPaths map[string]LookPath
+
+// SetupExecLookPaths mocks ExecLookPath with results of every
+// file. Looking up a file not in paths gets ErrLookPath.
+func SetupExecLookPaths(paths LookPaths) {
+	own(mockNameExecLookPath)
+	mockExecLookPath = paths.lookPath
+}
+
+func (paths LookPaths) lookPath(file string) (string, error) {
+	p, ok := paths[file]
+	if !ok {
 		return "", ErrLookPath
 	}
+
+	if p.Err != nil {
+		return "", p.Err
+	}
+
+	if p.Path == "" {
+		return file, nil
+	}
+
+	return p.Path, nil
 }
 
 // TeardownExecLookPath restores ExecLookPath to the original one.
 func TeardownExecLookPath() {
 	mockExecLookPath = exec.LookPath
+	disownAll(mockNameExecLookPath)
 }
 
 // SetupOsExit mocks OsExit.
 func SetupOsExit(override ...func(code int)) {
-	fn := func(code int) {}
+	own(mockNameOsExit)
+	mockOsExit = fakeOsExit(override)
+}
 
+func fakeOsExit(override []func(code int)) func(code int) {
 	if len(override) > 0 {
-		fn = override[0]
+		return override[0]
 	}
 
-	mockOsExit = fn
+	return func(code int) {}
 }
 
 // TeardownOsExit restores OsExit to the original one.
 func TeardownOsExit() {
 	mockOsExit = os.Exit
+	disownAll(mockNameOsExit)
 }
 
 // RedirectStdout mocks Stdout.
 func RedirectStdout() {
-	stdoutForward, Stdout, _ = os.Pipe()
+	own(mockNameStdout)
+	stdoutCapture = redirect()
+	Stdout = stdoutCapture.w
 }
 
 // DumpStdout dumps output from Stdout and restores it to the original one.
 func DumpStdout() string {
-	_ = Stdout.Close()
-
-	b, _ := ioutil.ReadAll(stdoutForward)
+	out := stdoutCapture.dump()
+	stdoutCapture = nil
 
 	Stdout = os.Stdout
+	disownAll(mockNameStdout)
 
-	return string(b)
+	return out
 }
 
 // RedirectStderr mocks Stderr.
 func RedirectStderr() {
-	stderrForward, Stderr, _ = os.Pipe()
+	own(mockNameStderr)
+	stderrCapture = redirect()
+	Stderr = stderrCapture.w
 }
 
 // DumpStderr dumps output from Stderr and restores it to the original one.
 func DumpStderr() string {
-	_ = Stderr.Close()
-
-	b, _ := ioutil.ReadAll(stderrForward)
+	out := stderrCapture.dump()
+	stderrCapture = nil
 
 	Stderr = os.Stderr
+	disownAll(mockNameStderr)
+
+	return out
+}
 
-	return string(b)
+// redirect gets a capture of a pipe whose write end replaces
+// Stdout or Stderr.
+func redirect() *capture {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	c := &capture{w: w, done: make(chan struct{})}
+
+	// the pipe is drained in background, otherwise writers block
+	// once the pipe buffer is full.
+	go func() {
+		_, _ = io.Copy(&c.buf, r)
+		_ = r.Close()
+		close(c.done)
+	}()
+
+	return c
+}
+
+// capture collects everything written to w.
+type capture struct {
+	w    *os.File
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+// dump closes w and gets everything written to it. It gets
+// an empty string for a nil capture.
+func (c *capture) dump() string {
+	if c == nil {
+		return ""
+	}
+
+	_ = c.w.Close()
+	<-c.done
+
+	return c.buf.String()
 }
 
 // Envs is used for override or set env
 type Envs map[string]string
 
-var oldEnvs Envs
+// envFrame is what a call of SetupEnvs or UnsetEnvs changed, so
+// that TeardownEnvs can restore it.
+type envFrame map[string]oldEnv
+
+type oldEnv struct {
+	value string
+	exist bool
+}
 
-const nonExistEnv = "deck: non exist"
+var envFrames []envFrame
 
-// SetupEnvs can override or set envs
+// SetupEnvs can override or set envs. Calls can be nested, and each
+// TeardownEnvs restores envs changed by the last one.
 func SetupEnvs(envs Envs) {
-	oldEnvs = make(Envs, len(envs))
+	keys := make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k)
+	}
 
+	frame := pushEnvFrame(keys)
 	for k, v := range envs {
-		if val, ok := os.LookupEnv(k); ok {
-			oldEnvs[k] = val
-		} else {
-			oldEnvs[k] = nonExistEnv
-		}
 		_ = os.Setenv(k, v)
 	}
+	envFrames = append(envFrames, frame)
 }
 
-// TeardownEnvs restores envs to original ones
-func TeardownEnvs() {
-	for k, v := range oldEnvs {
+// UnsetEnvs unsets envs like SetupEnvs, and TeardownEnvs
+// restores them as well.
+func UnsetEnvs(keys ...string) {
+	frame := pushEnvFrame(keys)
+	for _, k := range keys {
+		_ = os.Unsetenv(k)
+	}
+	envFrames = append(envFrames, frame)
+}
+
+// pushEnvFrame owns keys and gets their current values.
+func pushEnvFrame(keys []string) envFrame {
+	own(envMockNames(keys)...)
+
+	frame := make(envFrame, len(keys))
+	for _, k := range keys {
+		frame[k] = lookupEnv(k)
+	}
+
+	return frame
+}
+
+// popEnvFrame restores envs of frame and disowns them.
+func popEnvFrame(frame envFrame) {
+	keys := make([]string, 0, len(frame))
+	for k, e := range frame {
+		e.restore(k)
+		keys = append(keys, k)
+	}
+
+	disown(envMockNames(keys)...)
+}
+
+func envMockNames(keys []string) []string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = mockNameEnv + k
+	}
+	return names
+}
+
+func lookupEnv(k string) oldEnv {
+	value, exist := os.LookupEnv(k)
+	return oldEnv{value: value, exist: exist}
+}
+
+func (e oldEnv) restore(k string) {
+	if e.exist {
+		_ = os.Setenv(k, e.value)
+	} else {
 		_ = os.Unsetenv(k)
-		if v != nonExistEnv {
-			_ = os.Setenv(k, v)
-		}
 	}
 }
 
+// TeardownEnvs restores envs changed by the last SetupEnvs
+// or UnsetEnvs.
+func TeardownEnvs() {
+	if len(envFrames) == 0 {
+		return
+	}
+
+	frame := envFrames[len(envFrames)-1]
+	envFrames = envFrames[:len(envFrames)-1]
+
+	popEnvFrame(frame)
+}
+
 // RunCobraCmd executes a cobra command and get output and error
 func RunCobraCmd(cmd *cobra.Command, args ...string) (string, error) {
 	var b bytes.Buffer
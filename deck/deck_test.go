@@ -1,8 +1,16 @@
 package deck
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -49,6 +57,17 @@ func TestExecCommand(t *testing.T) {
 		at.Contains(err.Error(), errorCommand)
 	})
 
+	t.Run("context", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		cmd := ExecCommandContext(context.Background(), "test", "context")
+
+		b, err := cmd.CombinedOutput()
+		at.Nil(err)
+		at.Equal("[test context]", string(b))
+	})
+
 	t.Run("stderr", func(t *testing.T) {
 		SetupCmdStderr()
 		defer TeardownCmd()
@@ -62,25 +81,41 @@ func TestExecCommand(t *testing.T) {
 }
 
 func TestHelperCommand(t *testing.T) {
-	HandleCommand(func(args []string, expectStderr bool) {
-		if expectStderr {
-			_, _ = fmt.Fprintf(os.Stderr, "%v", args)
-			os.Exit(1)
+	HandleProcess(func(p *Process) int {
+		if p.ExpectStderr {
+			_, _ = fmt.Fprintf(p.Stderr, "%v", p.Args)
+			return 1
 		}
-		_, _ = fmt.Fprintf(os.Stdout, "%v", args)
+
+		switch p.Args[0] {
+		case "cat":
+			_, _ = io.Copy(p.Stdout, p.Stdin)
+		case "env":
+			for _, kv := range p.Env {
+				if strings.HasPrefix(kv, p.Args[1]+"=") {
+					_, _ = fmt.Fprint(p.Stdout, strings.TrimPrefix(kv, p.Args[1]+"="))
+				}
+			}
+		case "pwd":
+			_, _ = fmt.Fprint(p.Stdout, p.Dir)
+		case "exit":
+			code, _ := strconv.Atoi(p.Args[1])
+			return code
+		default:
+			_, _ = fmt.Fprintf(p.Stdout, "%v", p.Args)
+		}
+
+		return 0
 	})
 }
 
 func TestHandleCommand(t *testing.T) {
 	at := assert.New(t)
 
-	SetupEnvs(Envs{"GO_WANT_HELPER_COMMAND": "1"})
-	defer TeardownEnvs()
-
 	SetupOsExit()
 	defer TeardownOsExit()
 
-	os.Args = append(os.Args, "--", "test")
+	defer setupHelperProcess(t, "test")()
 
 	HandleCommand(func(args []string, expectStderr bool) {
 		at.Equal(1, len(args))
@@ -89,6 +124,120 @@ func TestHandleCommand(t *testing.T) {
 	})
 }
 
+func TestHandleProcess(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("stdin", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		cmd := ExecCommand("cat")
+		cmd.Stdin = strings.NewReader("kind: Pod")
+
+		b, err := cmd.Output()
+		at.Nil(err)
+		at.Equal("kind: Pod", string(b))
+		at.Equal("kind: Pod", Invocations()[0].Stdin)
+	})
+
+	t.Run("stdin not read", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		cmd := ExecCommand("pwd")
+		stdin, err := cmd.StdinPipe()
+		at.Nil(err)
+		defer func() { _ = stdin.Close() }()
+
+		at.Nil(cmd.Start())
+		_, err = stdin.Write([]byte("kind: Pod"))
+		at.Nil(err)
+
+		at.Nil(cmd.Wait())
+		at.Equal("kind: Pod", Invocations()[0].Stdin)
+	})
+
+	t.Run("exit code", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		err := ExecCommand("exit", "3").Run()
+
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		at.Equal(3, exitErr.ExitCode())
+	})
+
+	t.Run("env and dir", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		dir, err := ioutil.TempDir("", "deck-process")
+		at.Nil(err)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		cmd := ExecCommand("env", "DAWN_DECK_PROCESS")
+		cmd.Env = append(os.Environ(), "DAWN_DECK_PROCESS=1")
+		b, err := cmd.Output()
+		at.Nil(err)
+		at.Equal("1", string(b))
+
+		cmd = ExecCommand("pwd")
+		cmd.Dir = dir
+		b, err = cmd.Output()
+		at.Nil(err)
+		at.Equal(evalDir(t, dir), evalDir(t, string(b)))
+	})
+
+	t.Run("not helper process", func(t *testing.T) {
+		HandleProcess(func(p *Process) int {
+			at.Fail("should not be called")
+			return 0
+		})
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		var code int
+		SetupOsExit(func(c int) { code = c })
+		defer TeardownOsExit()
+
+		defer setupHelperProcess(t, "test")()
+
+		HandleProcess(func(p *Process) int {
+			at.Equal([]string{"test"}, p.Args)
+			at.NotEmpty(p.Env)
+			at.NotEmpty(p.Dir)
+			at.Equal(Stdout, p.Stdout)
+			at.Equal(Stderr, p.Stderr)
+			at.False(p.ExpectStderr)
+			return 2
+		})
+
+		at.Equal(2, code)
+	})
+}
+
+// setupHelperProcess makes the test process look like a helper
+// process of a faked command and returns a function to restore.
+func setupHelperProcess(t *testing.T, args ...string) func() {
+	dir, err := ioutil.TempDir("", "deck-helper")
+	assert.Nil(t, err)
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	_ = w.Close()
+
+	oldArgs, oldStdin := os.Args, os.Stdin
+	os.Args = append([]string{oldArgs[0], "--", helperMarker, filepath.Join(dir, "1"), ""}, args...)
+	os.Stdin = r
+
+	return func() {
+		os.Args, os.Stdin = oldArgs, oldStdin
+		_ = r.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
 func TestExecLookPath(t *testing.T) {
 	at := assert.New(t)
 
@@ -113,6 +262,35 @@ func TestExecLookPath(t *testing.T) {
 	})
 }
 
+func TestExecLookPaths(t *testing.T) {
+	at := assert.New(t)
+
+	errPodman := errors.New("podman: not installed")
+
+	SetupExecLookPaths(LookPaths{
+		"docker": {Path: "/usr/local/bin/docker"},
+		"podman": {Err: errPodman},
+		"git":    {},
+	})
+	defer TeardownExecLookPath()
+
+	bin, err := ExecLookPath("docker")
+	at.Nil(err)
+	at.Equal("/usr/local/bin/docker", bin)
+
+	bin, err = ExecLookPath("podman")
+	at.Equal(errPodman, err)
+	at.Equal("", bin)
+
+	bin, err = ExecLookPath("git")
+	at.Nil(err)
+	at.Equal("git", bin)
+
+	bin, err = ExecLookPath("helm")
+	at.Equal(ErrLookPath, err)
+	at.Equal("", bin)
+}
+
 func TestStdout(t *testing.T) {
 	at := assert.New(t)
 
@@ -137,6 +315,22 @@ func TestStderr(t *testing.T) {
 	at.Equal("stderr", output)
 }
 
+func TestLargeOutput(t *testing.T) {
+	at := assert.New(t)
+
+	large := strings.Repeat("deck", 1<<20)
+
+	RedirectStdout()
+	RedirectStderr()
+
+	_, _ = fmt.Fprint(Stdout, large)
+	_, _ = fmt.Fprint(Stderr, large)
+
+	at.Equal(large, DumpStdout())
+	at.Equal(large, DumpStderr())
+	at.Equal("", DumpStdout())
+}
+
 func TestEnvs(t *testing.T) {
 	at := assert.New(t)
 
@@ -152,10 +346,29 @@ func TestEnvs(t *testing.T) {
 	at.Equal(newValue, os.Getenv(key1))
 	at.Equal(newValue, os.Getenv(key2))
 
+	t.Run("nested", func(t *testing.T) {
+		SetupEnvs(Envs{key1: "3"})
+		UnsetEnvs(key2)
+
+		at.Equal("3", os.Getenv(key1))
+		_, ok := os.LookupEnv(key2)
+		at.False(ok)
+
+		TeardownEnvs()
+		at.Equal(newValue, os.Getenv(key2))
+
+		TeardownEnvs()
+		at.Equal(newValue, os.Getenv(key1))
+	})
+
 	TeardownEnvs()
 
 	at.Equal(oldValue, os.Getenv(key1))
-	at.Equal("", os.Getenv(key2))
+	_, ok := os.LookupEnv(key2)
+	at.False(ok)
+
+	TeardownEnvs()
+	at.Equal(oldValue, os.Getenv(key1))
 }
 
 func TestRunCobraCmd(t *testing.T) {
@@ -0,0 +1,291 @@
+package deck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// LoadEnvFile parses envs in a file of dotenv syntax:
+//
+//	# comment
+//	export NAME=value # comment
+//	SINGLE='literal $NAME'
+//	DOUBLE="line\nwith ${NAME} and ${EMPTY:-default}"
+//
+// Values in single quotes are literal. Values in double quotes can
+// have escapes and span lines. Unquoted values and values in double
+// quotes expand $NAME, ${NAME} and ${NAME:-default} with envs above
+// them in the file, or with the environment.
+func LoadEnvFile(file string) (Envs, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(fixturePath(file)))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnvs(file, string(b))
+}
+
+// SetupEnvFile is like SetupEnvs, but with envs loaded from
+// a file by LoadEnvFile.
+func SetupEnvFile(file string) {
+	envs, err := LoadEnvFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	SetupEnvs(envs)
+}
+
+// SetupEnvFile is like SetupEnvs, but with envs loaded from
+// a file by LoadEnvFile.
+func (d *Deck) SetupEnvFile(file string) {
+	d.t.Helper()
+
+	envs, err := LoadEnvFile(file)
+	if err != nil {
+		d.t.Fatal(err)
+		return
+	}
+
+	d.SetupEnvs(envs)
+}
+
+type envParser struct {
+	file string
+	src  string
+	pos  int
+	line int
+	envs Envs
+}
+
+func parseEnvs(file, src string) (Envs, error) {
+	p := &envParser{file: file, src: strings.Replace(src, "\r\n", "\n", -1), line: 1, envs: Envs{}}
+
+	for {
+		p.skip(" \t\n")
+		if p.eof() {
+			return p.envs, nil
+		}
+
+		if p.peek() == '#' {
+			p.skipComment()
+			continue
+		}
+
+		if err := p.parseEnv(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *envParser) parseEnv() error {
+	key := p.name()
+	if key == "export" && !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skip(" \t")
+		key = p.name()
+	}
+	if key == "" {
+		return p.errorf("invalid name")
+	}
+
+	p.skip(" \t")
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("missing = after %s", key)
+	}
+	p.pos++
+	p.skip(" \t")
+
+	var (
+		value string
+		err   error
+	)
+	switch {
+	case p.eof():
+	case p.peek() == '\'':
+		value, err = p.singleQuoted()
+	case p.peek() == '"':
+		value, err = p.doubleQuoted()
+	default:
+		value = p.unquoted()
+	}
+	if err != nil {
+		return err
+	}
+
+	p.skip(" \t")
+	if !p.eof() && p.peek() == '#' {
+		p.skipComment()
+	}
+	if !p.eof() && p.peek() != '\n' {
+		return p.errorf("unexpected %q after value of %s", p.peek(), key)
+	}
+
+	p.envs[key] = value
+
+	return nil
+}
+
+func (p *envParser) singleQuoted() (string, error) {
+	p.pos++
+	end := strings.IndexByte(p.src[p.pos:], '\'')
+	if end < 0 {
+		return "", p.errorf("unterminated single quote")
+	}
+
+	value := p.src[p.pos : p.pos+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 1
+
+	return value, nil
+}
+
+func (p *envParser) doubleQuoted() (string, error) {
+	p.pos++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				break
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		case '$':
+			b.WriteString(p.expand())
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", p.errorf("unterminated double quote")
+}
+
+func (p *envParser) unquoted() string {
+	var b strings.Builder
+	for !p.eof() && p.peek() != '\n' {
+		c := p.peek()
+		if c == '#' && (b.Len() == 0 || strings.ContainsAny(b.String()[b.Len()-1:], " \t")) {
+			break
+		}
+		p.pos++
+		if c == '$' {
+			b.WriteString(p.expand())
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return strings.TrimRight(b.String(), " \t")
+}
+
+// expand gets value of a variable following "$".
+func (p *envParser) expand() string {
+	if p.eof() {
+		return "$"
+	}
+
+	if p.peek() != '{' {
+		name := p.identifier()
+		if name == "" {
+			return "$"
+		}
+		return p.lookup(name)
+	}
+
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end < 0 {
+		return "$"
+	}
+	expr := p.src[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		if value := p.lookup(expr[:i]); value != "" {
+			return value
+		}
+		return expr[i+2:]
+	}
+
+	return p.lookup(expr)
+}
+
+func (p *envParser) lookup(name string) string {
+	if value, ok := p.envs[name]; ok {
+		return value
+	}
+	return lookupEnv(name).value
+}
+
+func (p *envParser) name() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c != '_' && c != '.' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') &&
+			!('0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// identifier scans the name of a variable in $NAME, which
+// unlike names of keys can't contain dots or start with a digit.
+func (p *envParser) identifier() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') &&
+			!(p.pos > start && '0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *envParser) skip(chars string) {
+	for !p.eof() && strings.IndexByte(chars, p.peek()) >= 0 {
+		p.next()
+	}
+}
+
+func (p *envParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+func (p *envParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *envParser) peek() byte { return p.src[p.pos] }
+
+func (p *envParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *envParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("deck: %s:%d: %s", p.file, p.line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,90 @@
+package deck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_EnvFile_LoadEnvFile(t *testing.T) {
+	at := assert.New(t)
+
+	envs, err := LoadEnvFile(filepath.Join("testdata", "envs", "app.env"))
+	at.Nil(err)
+	at.Equal(Envs{
+		"APP_NAME":    "deck",
+		"APP_PORT":    "8080",
+		"APP_URL":     "http://localhost:8080/deck",
+		"APP_TAG":     "v1#not-a-comment",
+		"APP_LITERAL": "${APP_NAME} # kept",
+		"APP_MESSAGE": "hello\t\"deck\"\nbye $APP_NAME",
+		"APP_CERT":    "-----BEGIN-----\nabc\n-----END-----",
+		"APP_REGION":  "us-east-1",
+		"APP_EMPTY":   "",
+	}, envs)
+
+	_, err = LoadEnvFile("not-exist.env")
+	at.NotNil(err)
+}
+
+func Test_Deck_EnvFile_Expand(t *testing.T) {
+	at := assert.New(t)
+
+	envs, err := parseEnvs("test.env", "HOST=example\nURL=$HOST.com\nDOTTED.NAME=$HOST_1-$HOST\nPRICE=\"$1.5\"")
+	at.Nil(err)
+	at.Equal(Envs{
+		"HOST":        "example",
+		"URL":         "example.com",
+		"DOTTED.NAME": "-example",
+		"PRICE":       "$1.5",
+	}, envs)
+}
+
+func Test_Deck_EnvFile_Errors(t *testing.T) {
+	at := assert.New(t)
+
+	for src, msg := range map[string]string{
+		"=value":                 "deck: test.env:1: invalid name",
+		"A=1\nB value":           "deck: test.env:2: missing = after B",
+		"A='1":                   "deck: test.env:1: unterminated single quote",
+		"A=\"1\n2":               "deck: test.env:2: unterminated double quote",
+		"A=\"1\"\n\nB='2' three": "deck: test.env:3: unexpected 't' after value of B",
+	} {
+		_, err := parseEnvs("test.env", src)
+		if at.NotNil(err, src) {
+			at.Equal(msg, err.Error(), src)
+		}
+	}
+}
+
+func Test_Deck_EnvFile_SetupEnvFile(t *testing.T) {
+	at := assert.New(t)
+
+	file := filepath.Join("testdata", "envs", "app.env")
+
+	t.Run("legacy", func(t *testing.T) {
+		SetupEnvFile(file)
+		at.Equal("deck", os.Getenv("APP_NAME"))
+
+		TeardownEnvs()
+		_, ok := os.LookupEnv("APP_NAME")
+		at.False(ok)
+
+		at.Panics(func() { SetupEnvFile("not-exist.env") })
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		New(tb).SetupEnvFile(file)
+		at.Equal("8080", os.Getenv("APP_PORT"))
+
+		New(tb).SetupEnvFile("not-exist.env")
+		at.Contains(tb.fatal, "not-exist.env")
+
+		tb.cleanup()
+		_, ok := os.LookupEnv("APP_PORT")
+		at.False(ok)
+	})
+}
@@ -0,0 +1,63 @@
+package deck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exitPanic is panicked by OsExit mocked by AssertExits to stop
+// the calling goroutine like os.Exit does.
+type exitPanic struct {
+	code int
+}
+
+// AssertExits asserts fn calls OsExit with code. Unlike SetupOsExit,
+// OsExit stops fn, so code after it does not run. It fails if fn
+// returns without calling OsExit. OsExit must be called from the
+// goroutine of fn, and fn must not recover its panic.
+func AssertExits(t testing.TB, code int, fn func()) bool {
+	t.Helper()
+
+	own(mockNameOsExit)
+	defer disown(mockNameOsExit)
+
+	old := mockOsExit
+	mockOsExit = panicOsExit
+	defer func() { mockOsExit = old }()
+
+	return assertExits(t, code, fn)
+}
+
+func panicOsExit(code int) {
+	panic(exitPanic{code})
+}
+
+func assertExits(t testing.TB, code int, fn func()) bool {
+	t.Helper()
+
+	got, exited := catchExit(fn)
+	if !exited {
+		return assert.Fail(t, "deck: OsExit was not called")
+	}
+
+	return assert.Equalf(t, code, got, "deck: OsExit was called with %d", got)
+}
+
+// catchExit runs fn and reports the code if it is stopped by
+// panicOsExit. Other panics are passed through.
+func catchExit(fn func()) (code int, exited bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(exitPanic)
+			if !ok {
+				panic(r)
+			}
+			code, exited = e.code, true
+		}
+	}()
+
+	fn()
+
+	return 0, false
+}
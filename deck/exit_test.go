@@ -0,0 +1,49 @@
+package deck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Exit_AssertExits(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("stop at exit", func(t *testing.T) {
+		var after bool
+		at.True(AssertExits(t, 2, func() {
+			OsExit(2)
+			after = true
+		}))
+		at.False(after)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		var code int
+		SetupOsExit(func(c int) { code = c })
+		defer TeardownOsExit()
+
+		AssertExits(t, 1, func() { OsExit(1) })
+
+		OsExit(3)
+		at.Equal(3, code)
+	})
+
+	t.Run("other panic", func(t *testing.T) {
+		at.PanicsWithValue("boom", func() {
+			AssertExits(t, 1, func() { panic("boom") })
+		})
+	})
+
+	t.Run("not exited", func(t *testing.T) {
+		ft := &fakeTB{}
+		at.False(assertExits(ft, 1, func() {}))
+		at.Contains(ft.fatal, "deck: OsExit was not called")
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		ft := &fakeTB{}
+		at.False(assertExits(ft, 1, func() { panicOsExit(2) }))
+		at.Contains(ft.fatal, "deck: OsExit was called with 2")
+	})
+}
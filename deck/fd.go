@@ -0,0 +1,65 @@
+package deck
+
+import (
+	"os"
+	"sync"
+)
+
+// fdMu serializes captures of file descriptors, which are
+// shared by the whole process.
+var fdMu sync.Mutex
+
+// CaptureStdio runs fn with file descriptors of the real os.Stdout
+// and os.Stderr redirected, and gets everything written to them.
+// Unlike RedirectStdout and RedirectStderr, output of the log
+// package, fmt.Println, cgo code or child processes inheriting
+// them is captured too. Descriptors are restored when fn returns
+// or panics. It is not supported on Windows.
+func CaptureStdio(fn func()) (stdout, stderr string, err error) {
+	own(mockNameStdout, mockNameStderr)
+	defer disown(mockNameStdout, mockNameStderr)
+
+	return captureStdio(fn)
+}
+
+// CaptureStdio is like the package level CaptureStdio, but it
+// fails the test of the Deck instead of panicking when Stdout or
+// Stderr is mocked by another Deck.
+func (d *Deck) CaptureStdio(fn func()) (stdout, stderr string, err error) {
+	d.t.Helper()
+
+	if !d.claim(mockNameStdout, nil) || !d.claim(mockNameStderr, nil) {
+		return
+	}
+
+	return captureStdio(fn)
+}
+
+func captureStdio(fn func()) (stdout, stderr string, err error) {
+	fdMu.Lock()
+	defer fdMu.Unlock()
+
+	outCapture, restoreOut, err := redirectFd(os.Stdout)
+	if err != nil {
+		return
+	}
+
+	errCapture, restoreErr, err := redirectFd(os.Stderr)
+	if err != nil {
+		_ = restoreOut()
+		_ = outCapture.dump()
+		return
+	}
+
+	defer func() {
+		err = restoreErr()
+		if e := restoreOut(); err == nil {
+			err = e
+		}
+		stdout, stderr = outCapture.dump(), errCapture.dump()
+	}()
+
+	fn()
+
+	return
+}
@@ -0,0 +1,54 @@
+package deck
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Fd_CaptureStdio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file descriptors are not captured on windows")
+	}
+
+	at := assert.New(t)
+
+	t.Run("capture", func(t *testing.T) {
+		stdout, stderr, err := CaptureStdio(func() {
+			fmt.Println("println")
+			log.New(os.Stderr, "", 0).Print("log")
+
+			cmd := exec.Command("sh", "-c", "echo child")
+			cmd.Stdout = os.Stdout
+			at.Nil(cmd.Run())
+		})
+
+		at.Nil(err)
+		at.Equal("println\nchild\n", stdout)
+		at.Equal("log\n", stderr)
+	})
+
+	t.Run("restore on panic", func(t *testing.T) {
+		at.Panics(func() {
+			_, _, _ = CaptureStdio(func() { panic("boom") })
+		})
+
+		stdout, _, err := CaptureStdio(func() { fmt.Print("restored") })
+		at.Nil(err)
+		at.Equal("restored", stdout)
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		d := New(t)
+		_, stderr, err := d.CaptureStdio(func() { fmt.Fprint(os.Stderr, "deck") })
+		at.Nil(err)
+		at.Equal("deck", stderr)
+
+		at.Panics(func() { RedirectStdout() })
+	})
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package deck
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectFd points the file descriptor of f to a capture. The
+// returned function points it back.
+func redirectFd(f *os.File) (*capture, func() error, error) {
+	fd := int(f.Fd())
+
+	saved, err := unix.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := redirect()
+	if err = unix.Dup2(int(c.w.Fd()), fd); err != nil {
+		_ = unix.Close(saved)
+		_ = c.dump()
+		return nil, nil, err
+	}
+
+	restore := func() error {
+		err := unix.Dup2(saved, fd)
+		_ = unix.Close(saved)
+		return err
+	}
+
+	return c, restore, nil
+}
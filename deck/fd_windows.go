@@ -0,0 +1,11 @@
+package deck
+
+import (
+	"errors"
+	"os"
+)
+
+// redirectFd is not supported on Windows.
+func redirectFd(_ *os.File) (*capture, func() error, error) {
+	return nil, nil, errors.New("deck: capturing file descriptors is not supported on windows")
+}
@@ -0,0 +1,126 @@
+package deck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/stretchr/testify/assert"
+)
+
+// Normalizer replaces unstable parts of output before it is
+// compared with a golden file.
+type Normalizer func(s string) string
+
+// NormalizeRegexp replaces matches of expr with repl, which can
+// refer to submatches like regexp.ReplaceAllString.
+func NormalizeRegexp(expr, repl string) Normalizer {
+	re := regexp.MustCompile(expr)
+	return func(s string) string {
+		return re.ReplaceAllString(s, repl)
+	}
+}
+
+// timestampRegexp matches dates and times like 2006-01-02,
+// 2006-01-02T15:04:05.999Z07:00 and 2006/01/02 15:04:05.
+var timestampRegexp = regexp.MustCompile(
+	`\d{4}[-/]\d{2}[-/]\d{2}([T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?)?`)
+
+// NormalizeTimestamps replaces dates and times with "<timestamp>".
+func NormalizeTimestamps(s string) string {
+	return timestampRegexp.ReplaceAllString(s, "<timestamp>")
+}
+
+// NormalizeTempPaths replaces the temporary directory and the
+// first element under it, which is usually created with a random
+// name by ioutil.TempDir, with "<tmp>".
+func NormalizeTempPaths(s string) string {
+	dir := filepath.Clean(os.TempDir())
+	sep := regexp.QuoteMeta(string(filepath.Separator))
+	re := regexp.MustCompile(regexp.QuoteMeta(dir) + `(` + sep + `[^\s` + sep + `"']+)?`)
+	return re.ReplaceAllString(s, "<tmp>")
+}
+
+// NormalizeANSI removes ANSI escape sequences.
+func NormalizeANSI(s string) string {
+	return StripANSI(s)
+}
+
+// AssertGolden asserts got equals the content of golden file
+// testdata/<name>.golden, after got is normalized by normalizers.
+// The golden file is written with got instead when the test runs
+// with -deck.update, or an -update flag defined by the package
+// under test. It shows a unified diff on mismatch.
+func AssertGolden(t *testing.T, name, got string, normalizers ...Normalizer) bool {
+	t.Helper()
+	return assertGolden(t, name, got, normalizers)
+}
+
+// AssertGolden is like the package level AssertGolden, but
+// failures are reported to the test of the Deck.
+func (d *Deck) AssertGolden(name, got string, normalizers ...Normalizer) bool {
+	d.t.Helper()
+	return assertGolden(d.t, name, got, normalizers)
+}
+
+func assertGolden(t assert.TestingT, name, got string, normalizers []Normalizer) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	for _, normalize := range normalizers {
+		got = normalize(got)
+	}
+
+	file := goldenFile(name)
+
+	if shouldUpdate() {
+		if err := writeGolden(file, got); err != nil {
+			return assert.Fail(t, fmt.Sprintf("deck: failed to update golden file: %s", err))
+		}
+		return true
+	}
+
+	b, err := ioutil.ReadFile(filepath.Clean(file))
+	if os.IsNotExist(err) {
+		return assert.Fail(t, fmt.Sprintf("deck: golden file %s does not exist, "+
+			"run tests with -args -deck.update to create it", file))
+	}
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("deck: failed to read golden file: %s", err))
+	}
+
+	if want := string(b); want != got {
+		return assert.Fail(t, fmt.Sprintf("deck: output does not match golden file %s\n%s",
+			file, goldenDiff(file, want, got)))
+	}
+
+	return true
+}
+
+func goldenFile(name string) string {
+	return fixturePath(filepath.Join("testdata", filepath.FromSlash(name)+".golden"))
+}
+
+func writeGolden(file, content string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(content), 0600)
+}
+
+func goldenDiff(file, want, got string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(want),
+		B:        difflib.SplitLines(got),
+		FromFile: file,
+		ToFile:   "got",
+		Context:  3,
+	})
+	return strings.TrimSuffix(diff, "\n")
+}
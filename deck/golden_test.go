@@ -0,0 +1,70 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Golden_AssertGolden(t *testing.T) {
+	at := assert.New(t)
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	got := "Usage: deck [flags]\n  built at \x1b[1m2021-03-09T04:02:21Z\x1b[0m in " +
+		filepath.Join(os.TempDir(), "deck-build123", "cache") + "\n"
+
+	t.Run("match", func(t *testing.T) {
+		at.True(AssertGolden(t, "golden/usage", got,
+			NormalizeANSI, NormalizeTimestamps, NormalizeTempPaths, NormalizeRegexp(`\\`, "/")))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		tb := &fakeTB{}
+		at.False(assertGolden(tb, "golden/usage", "Usage: deck\n", nil))
+		at.Contains(tb.fatal, "deck: output does not match golden file")
+		at.Contains(tb.fatal, "-Usage: deck [flags]\n")
+		at.Contains(tb.fatal, "+Usage: deck\n")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		tb := &fakeTB{}
+		at.False(assertGolden(tb, "golden/missing", got, nil))
+		at.Contains(tb.fatal, "does not exist")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "deck-golden")
+		at.Nil(err)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		old := packageDir
+		packageDir = dir
+		defer func() { packageDir = old }()
+
+		*updateFlag = true
+		defer func() { *updateFlag = false }()
+
+		d := New(t)
+		at.True(d.AssertGolden("nested/usage", "updated\n"))
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "testdata", "nested", "usage.golden"))
+		at.Nil(err)
+		at.Equal("updated\n", string(b))
+	})
+}
+
+func Test_Deck_Golden_Normalizers(t *testing.T) {
+	at := assert.New(t)
+
+	at.Equal("at <timestamp> and <timestamp>.",
+		NormalizeTimestamps("at 2021/03/09 04:02:21 and 2021-03-09T04:02:21.123+08:00."))
+	at.Equal("<tmp> and <tmp>",
+		NormalizeTempPaths(os.TempDir()+" and "+filepath.Join(os.TempDir(), "x1")))
+	at.Equal("v1", NormalizeRegexp(`v\d+\.\d+`, "v1")("v1.2"))
+}
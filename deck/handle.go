@@ -0,0 +1,466 @@
+package deck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+// Deck owns mocks of a single test. Everything it mocks is
+// restored by t.Cleanup, so nothing leaks into later tests.
+//
+// ExecCommand, ExecLookPath and OsExit of a Deck are served by
+// its own state and can be injected into code under test from
+// parallel tests. Setup methods additionally install the mocks
+// into the package level wrappers. Only one Deck can install a
+// wrapper at the same time, and another Deck trying to install
+// it fails its test.
+type Deck struct {
+	t        testing.TB
+	cmd      *commander
+	lookPath func(file string) (string, error)
+	osExit   func(code int)
+
+	stdout, stderr *capture
+
+	shims   *shims
+	console *Console
+}
+
+// New gets a Deck owned by t.
+func New(t testing.TB) *Deck {
+	d := &Deck{
+		t:        t,
+		cmd:      &commander{},
+		lookPath: exec.LookPath,
+		osExit:   os.Exit,
+	}
+
+	t.Cleanup(d.cmd.reset)
+
+	return d
+}
+
+const (
+	mockNameExecCommand  = "ExecCommand"
+	mockNameExecLookPath = "ExecLookPath"
+	mockNameOsExit       = "OsExit"
+	mockNameStdout       = "Stdout"
+	mockNameStderr       = "Stderr"
+	mockNameStdin        = "Stdin"
+	mockNameClock        = "Clock"
+	mockNameWorkDir      = "working directory"
+	mockNameEnv          = "env "
+)
+
+var (
+	ownersMu sync.Mutex
+	owners   = map[string]*Deck{}
+	// legacyRefs counts how many times a mock owned by
+	// legacyOwner is installed, e.g. by nested SetupEnvs.
+	legacyRefs = map[string]int{}
+)
+
+// legacyOwner owns mocks installed by package level functions,
+// like SetupCmd, until they are restored.
+var legacyOwner = &Deck{}
+
+func (d *Deck) name() string {
+	if d == legacyOwner {
+		return "a package level Setup function"
+	}
+	return d.t.Name()
+}
+
+// claim makes d the owner of a package level mock until the
+// test ends. It fails the test if the mock is owned by another
+// Deck or a package level function. Every claim registers its own
+// restore, and restores run in reverse order when the test ends,
+// so each one undoes what was installed after the claim. restore
+// is nil for functions which restore the mock before returning.
+func (d *Deck) claim(mock string, restore func()) bool {
+	d.t.Helper()
+
+	ownersMu.Lock()
+	owner, ok := owners[mock]
+	if !ok {
+		owners[mock] = d
+	}
+	ownersMu.Unlock()
+
+	if ok && owner != d {
+		d.t.Fatalf("deck: %s is already mocked by %s", mock, owner.name())
+		return false
+	}
+
+	// the owner is removed after all restores of the mock.
+	if !ok {
+		d.t.Cleanup(func() {
+			ownersMu.Lock()
+			delete(owners, mock)
+			ownersMu.Unlock()
+		})
+	}
+
+	if restore != nil {
+		d.t.Cleanup(restore)
+	}
+
+	return true
+}
+
+// own makes package level functions the owner of mocks until
+// they are disowned as many times. It panics if any of them
+// is owned by a Deck.
+func own(mocks ...string) {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+
+	for _, mock := range mocks {
+		if owner, ok := owners[mock]; ok && owner != legacyOwner {
+			panic(fmt.Sprintf("deck: %s is already mocked by %s", mock, owner.name()))
+		}
+	}
+
+	for _, mock := range mocks {
+		owners[mock] = legacyOwner
+		legacyRefs[mock]++
+	}
+}
+
+// checkNotOwned panics if a package level mock is owned by a Deck.
+func checkNotOwned(mock string) {
+	ownersMu.Lock()
+	owner, ok := owners[mock]
+	ownersMu.Unlock()
+
+	if ok && owner != legacyOwner {
+		panic(fmt.Sprintf("deck: %s is already mocked by %s", mock, owner.name()))
+	}
+}
+
+// disown undoes own of mocks once.
+func disown(mocks ...string) {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+
+	for _, mock := range mocks {
+		if owners[mock] != legacyOwner {
+			continue
+		}
+
+		if legacyRefs[mock]--; legacyRefs[mock] <= 0 {
+			delete(owners, mock)
+			delete(legacyRefs, mock)
+		}
+	}
+}
+
+// disownAll undoes every own of mocks, since a Teardown
+// function restores a mock no matter how many times it is
+// installed.
+func disownAll(mocks ...string) {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+
+	for _, mock := range mocks {
+		if owners[mock] == legacyOwner {
+			delete(owners, mock)
+			delete(legacyRefs, mock)
+		}
+	}
+}
+
+// ExecCommand is a faked exec.Command served by the Deck.
+func (d *Deck) ExecCommand(name string, arg ...string) *exec.Cmd {
+	return d.cmd.command(name, arg...)
+}
+
+// ExecCommandContext is a faked exec.CommandContext served
+// by the Deck.
+func (d *Deck) ExecCommandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	return d.cmd.commandContext(ctx, name, arg...)
+}
+
+// SetupCmd installs ExecCommand and ExecCommandContext of the
+// Deck into the package level ones.
+func (d *Deck) SetupCmd() {
+	d.t.Helper()
+	d.setupCmd(false, false)
+}
+
+// SetupCmdError is like SetupCmd, but running the returned
+// command always gets an error.
+func (d *Deck) SetupCmdError() {
+	d.t.Helper()
+	d.setupCmd(true, false)
+}
+
+// SetupCmdStderr is like SetupCmd, but the second parameter of
+// the handler function in HandleCommand will be true.
+func (d *Deck) SetupCmdStderr() {
+	d.t.Helper()
+	d.setupCmd(false, true)
+}
+
+func (d *Deck) setupCmd(expectError, expectStderr bool) {
+	d.t.Helper()
+
+	restore := func() {
+		mockExecCommand = exec.Command
+		mockExecCommandContext = exec.CommandContext
+	}
+
+	if d.claim(mockNameExecCommand, restore) {
+		d.cmd.setup(expectError, expectStderr)
+		mockExecCommand = d.cmd.command
+		mockExecCommandContext = d.cmd.commandContext
+	}
+}
+
+// SetupCmdReplay is like SetupCmd, but commands are recorded
+// into or replayed from a transcript file. See SetupCmdReplay
+// for details. Recorded commands are saved when the test ends.
+func (d *Deck) SetupCmdReplay(file string) {
+	d.t.Helper()
+
+	if err := d.cmd.setupReplay(file); err != nil {
+		d.t.Fatal(err)
+		return
+	}
+
+	d.t.Cleanup(func() {
+		if err := d.cmd.saveTranscript(); err != nil {
+			d.t.Error(err)
+		}
+	})
+
+	d.setupCmd(false, false)
+}
+
+// OnCommand registers a stub served by ExecCommand of the Deck.
+// See OnCommand for details.
+func (d *Deck) OnCommand(name string, match ArgsMatcher) *Stub {
+	return d.cmd.onCommand(name, match)
+}
+
+// Invocations gets all commands faked by the Deck which were run.
+func (d *Deck) Invocations() []Invocation {
+	return d.cmd.invocations()
+}
+
+// FindInvocations gets invocations of the Deck matched by call.
+func (d *Deck) FindInvocations(c Call) []Invocation {
+	return findInvocations(d.Invocations(), c)
+}
+
+// AssertCalled asserts a command matched by call was run.
+func (d *Deck) AssertCalled(c Call) bool {
+	d.t.Helper()
+	return assertCalled(d.t, d.Invocations(), c)
+}
+
+// AssertCalledTimes asserts a command matched by call was run
+// exactly times.
+func (d *Deck) AssertCalledTimes(times int, c Call) bool {
+	d.t.Helper()
+	return assertCalledTimes(d.t, d.Invocations(), times, c)
+}
+
+// AssertCalledOnce asserts a command matched by call was run
+// exactly once.
+func (d *Deck) AssertCalledOnce(c Call) bool {
+	d.t.Helper()
+	return assertCalledTimes(d.t, d.Invocations(), 1, c)
+}
+
+// AssertNotCalled asserts no command matched by call was run.
+func (d *Deck) AssertNotCalled(c Call) bool {
+	d.t.Helper()
+	return assertCalledTimes(d.t, d.Invocations(), 0, c)
+}
+
+// AssertCalledInOrder asserts commands matched by calls were
+// run in the given order.
+func (d *Deck) AssertCalledInOrder(calls ...Call) bool {
+	d.t.Helper()
+	return assertCalledInOrder(d.t, d.Invocations(), calls...)
+}
+
+// ExecLookPath is a faked exec.LookPath served by the Deck.
+func (d *Deck) ExecLookPath(file string) (string, error) {
+	return d.lookPath(file)
+}
+
+// SetupExecLookPath mocks ExecLookPath of the Deck and installs
+// it into the package level ExecLookPath.
+func (d *Deck) SetupExecLookPath() {
+	d.t.Helper()
+	d.setupExecLookPath(lookPathAsIs)
+}
+
+// SetupExecLookPathError is like SetupExecLookPath, but always
+// returns an error.
+func (d *Deck) SetupExecLookPathError() {
+	d.t.Helper()
+	d.setupExecLookPath(lookPathError)
+}
+
+// SetupExecLookPaths is like SetupExecLookPath, but with results
+// of every file. See SetupExecLookPaths for details.
+func (d *Deck) SetupExecLookPaths(paths LookPaths) {
+	d.t.Helper()
+	d.setupExecLookPath(paths.lookPath)
+}
+
+func (d *Deck) setupExecLookPath(fn func(file string) (string, error)) {
+	d.t.Helper()
+
+	if d.claim(mockNameExecLookPath, func() { mockExecLookPath = exec.LookPath }) {
+		d.lookPath = fn
+		mockExecLookPath = d.ExecLookPath
+	}
+}
+
+// OsExit is a faked os.Exit served by the Deck.
+func (d *Deck) OsExit(code int) {
+	d.osExit(code)
+}
+
+// SetupOsExit mocks OsExit of the Deck and installs it into the
+// package level OsExit.
+func (d *Deck) SetupOsExit(override ...func(code int)) {
+	d.t.Helper()
+
+	if d.claim(mockNameOsExit, func() { mockOsExit = os.Exit }) {
+		d.osExit = fakeOsExit(override)
+		mockOsExit = d.OsExit
+	}
+}
+
+// AssertExits is like the package level AssertExits, but the exit
+// is caught by OsExit of the Deck, which is installed into the
+// package level OsExit until the test ends.
+func (d *Deck) AssertExits(code int, fn func()) bool {
+	d.t.Helper()
+
+	if !d.claim(mockNameOsExit, func() { mockOsExit = os.Exit }) {
+		return false
+	}
+
+	old := d.osExit
+	d.osExit = panicOsExit
+	mockOsExit = d.OsExit
+	defer func() { d.osExit = old }()
+
+	return assertExits(d.t, code, fn)
+}
+
+// RedirectStdout mocks Stdout until DumpStdout is called
+// or the test ends.
+func (d *Deck) RedirectStdout() {
+	d.t.Helper()
+
+	c := redirect()
+	restore := func() {
+		if d.stdout == c {
+			_ = d.DumpStdout()
+		}
+		_ = c.dump()
+	}
+
+	if !d.claim(mockNameStdout, restore) {
+		_ = c.dump()
+		return
+	}
+
+	// output of the last redirect is discarded.
+	_ = d.stdout.dump()
+	d.stdout = c
+	Stdout = c.w
+}
+
+// DumpStdout dumps output from Stdout and restores it.
+func (d *Deck) DumpStdout() string {
+	if d.stdout == nil {
+		return ""
+	}
+
+	out := d.stdout.dump()
+	d.stdout = nil
+
+	Stdout = os.Stdout
+
+	return out
+}
+
+// RedirectStderr mocks Stderr until DumpStderr is called
+// or the test ends.
+func (d *Deck) RedirectStderr() {
+	d.t.Helper()
+
+	c := redirect()
+	restore := func() {
+		if d.stderr == c {
+			_ = d.DumpStderr()
+		}
+		_ = c.dump()
+	}
+
+	if !d.claim(mockNameStderr, restore) {
+		_ = c.dump()
+		return
+	}
+
+	// output of the last redirect is discarded.
+	_ = d.stderr.dump()
+	d.stderr = c
+	Stderr = c.w
+}
+
+// DumpStderr dumps output from Stderr and restores it.
+func (d *Deck) DumpStderr() string {
+	if d.stderr == nil {
+		return ""
+	}
+
+	out := d.stderr.dump()
+	d.stderr = nil
+
+	Stderr = os.Stderr
+
+	return out
+}
+
+// SetupEnvs overrides or sets envs until the test ends. Calls
+// can be nested, and original envs are restored at last.
+func (d *Deck) SetupEnvs(envs Envs) {
+	d.t.Helper()
+
+	for k, v := range envs {
+		if d.claimEnv(k) {
+			_ = os.Setenv(k, v)
+		}
+	}
+}
+
+// UnsetEnvs unsets envs until the test ends.
+func (d *Deck) UnsetEnvs(keys ...string) {
+	d.t.Helper()
+
+	for _, k := range keys {
+		if d.claimEnv(k) {
+			_ = os.Unsetenv(k)
+		}
+	}
+}
+
+func (d *Deck) claimEnv(k string) bool {
+	d.t.Helper()
+
+	old := lookupEnv(k)
+	return d.claim(mockNameEnv+k, func() { old.restore(k) })
+}
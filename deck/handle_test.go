@@ -0,0 +1,348 @@
+package deck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTB struct {
+	testing.TB
+	name     string
+	fatal    string
+	cleanups []func()
+}
+
+func (tb *fakeTB) Helper()                                   {}
+func (tb *fakeTB) Name() string                              { return tb.name }
+func (tb *fakeTB) Errorf(format string, args ...interface{}) { tb.fatal = fmt.Sprintf(format, args...) }
+func (tb *fakeTB) Fatalf(format string, args ...interface{}) { tb.fatal = fmt.Sprintf(format, args...) }
+func (tb *fakeTB) Error(args ...interface{})                 { tb.fatal = fmt.Sprint(args...) }
+func (tb *fakeTB) Fatal(args ...interface{})                 { tb.fatal = fmt.Sprint(args...) }
+func (tb *fakeTB) Cleanup(fn func())                         { tb.cleanups = append(tb.cleanups, fn) }
+
+func (tb *fakeTB) cleanup() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+	tb.cleanups = nil
+}
+
+func Test_Deck_Handle_Cmd(t *testing.T) {
+	t.Parallel()
+
+	at := assert.New(t)
+
+	d := New(t)
+	d.OnCommand("git", Args("status")).Stdout("clean")
+
+	b, err := d.ExecCommand("git", "status").Output()
+	at.Nil(err)
+	at.Equal("clean", string(b))
+
+	b, err = d.ExecCommand("git", "log").CombinedOutput()
+	at.Nil(err)
+	at.Equal("[git log]", string(b))
+
+	status := Call{Name: "git", Args: Args("status")}
+	d.AssertCalled(status)
+	d.AssertCalledOnce(status)
+	d.AssertCalledTimes(2, Call{Name: "git"})
+	d.AssertNotCalled(Call{Name: "hg"})
+	d.AssertCalledInOrder(status, Call{Name: "git", Args: Args("log")})
+	at.Len(d.FindInvocations(status), 1)
+
+	b, err = d.ExecCommandContext(context.Background(), "git", "status").Output()
+	at.Nil(err)
+	at.Equal("clean", string(b))
+}
+
+func Test_Deck_Handle_SetupCmd(t *testing.T) {
+	at := assert.New(t)
+
+	tb := &fakeTB{name: "owner"}
+	d := New(tb)
+
+	d.SetupCmdError()
+	_, err := ExecCommand("test", "error").CombinedOutput()
+	at.NotNil(err)
+
+	d.SetupCmdStderr()
+	b, err := ExecCommand("test", "stderr").CombinedOutput()
+	at.NotNil(err)
+	at.Equal("[test stderr]", string(b))
+
+	d.SetupCmd()
+	b, err = ExecCommand("test", "success").CombinedOutput()
+	at.Nil(err)
+	at.Equal("[test success]", string(b))
+	b, err = ExecCommandContext(context.Background(), "test", "context").CombinedOutput()
+	at.Nil(err)
+	at.Equal("[test context]", string(b))
+	at.Len(d.Invocations(), 3)
+
+	at.Panics(SetupCmd)
+
+	tb.cleanup()
+
+	at.Empty(tb.fatal)
+	at.Nil(d.Invocations())
+
+	b, err = ExecCommand("echo", "restored").Output()
+	at.Nil(err)
+	at.Equal("restored\n", string(b))
+}
+
+func Test_Deck_Handle_Conflict(t *testing.T) {
+	at := assert.New(t)
+
+	owner := &fakeTB{name: "owner"}
+	other := &fakeTB{name: "other"}
+	defer owner.cleanup()
+	defer other.cleanup()
+
+	New(owner).SetupOsExit()
+	New(other).SetupOsExit()
+
+	at.Equal("deck: OsExit is already mocked by owner", other.fatal)
+	at.Empty(owner.fatal)
+
+	owner.cleanup()
+	other.fatal = ""
+
+	d := New(other)
+	d.SetupOsExit()
+	d.SetupOsExit()
+	at.Empty(other.fatal)
+}
+
+func Test_Deck_Handle_LegacyConflict(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("cmd", func(t *testing.T) {
+		SetupCmd()
+		defer TeardownCmd()
+
+		OnCommand("git", AnyArgs).Stdout("legacy")
+
+		tb := &fakeTB{name: "owner"}
+		New(tb).SetupCmd()
+		tb.cleanup()
+
+		at.Equal("deck: ExecCommand is already mocked by a package level Setup function", tb.fatal)
+
+		b, err := ExecCommand("git", "status").Output()
+		at.Nil(err)
+		at.Equal("legacy", string(b))
+	})
+
+	t.Run("envs", func(t *testing.T) {
+		key := "DAWN_DECK_LEGACY"
+
+		SetupEnvs(Envs{key: "1"})
+		SetupEnvs(Envs{key: "2"})
+		TeardownEnvs()
+
+		tb := &fakeTB{name: "owner"}
+		New(tb).SetupEnvs(Envs{key: "3"})
+		at.Equal("deck: env DAWN_DECK_LEGACY is already mocked by a package level Setup function", tb.fatal)
+		at.Equal("1", os.Getenv(key))
+
+		TeardownEnvs()
+
+		tb = &fakeTB{name: "owner"}
+		New(tb).SetupEnvs(Envs{key: "3"})
+		at.Empty(tb.fatal)
+		at.Equal("3", os.Getenv(key))
+
+		tb.cleanup()
+		_, ok := os.LookupEnv(key)
+		at.False(ok)
+	})
+
+	t.Run("restored", func(t *testing.T) {
+		SetupOsExit()
+		SetupOsExit()
+		TeardownOsExit()
+
+		tb := &fakeTB{name: "owner"}
+		New(tb).SetupOsExit()
+		tb.cleanup()
+
+		at.Empty(tb.fatal)
+	})
+}
+
+func Test_Deck_Handle_ExecLookPath(t *testing.T) {
+	at := assert.New(t)
+
+	tb := &fakeTB{name: "owner"}
+	d := New(tb)
+
+	d.SetupExecLookPath()
+	bin, err := ExecLookPath("test")
+	at.Nil(err)
+	at.Equal("test", bin)
+
+	d.SetupExecLookPathError()
+	_, err = ExecLookPath("test")
+	at.Equal(ErrLookPath, err)
+
+	d.SetupExecLookPaths(LookPaths{"docker": {Path: "/usr/local/bin/docker"}})
+	bin, err = ExecLookPath("docker")
+	at.Nil(err)
+	at.Equal("/usr/local/bin/docker", bin)
+
+	at.Panics(SetupExecLookPath)
+	at.Panics(func() { SetupExecLookPaths(nil) })
+
+	tb.cleanup()
+
+	_, err = ExecLookPath("deck-not-exist")
+	at.NotNil(err)
+	at.NotEqual(ErrLookPath, err)
+}
+
+func Test_Deck_Handle_OsExit(t *testing.T) {
+	at := assert.New(t)
+
+	tb := &fakeTB{name: "owner"}
+	defer tb.cleanup()
+
+	var code int
+	New(tb).SetupOsExit(func(c int) { code = c })
+
+	OsExit(3)
+	at.Equal(3, code)
+
+	at.Panics(func() { SetupOsExit() })
+}
+
+func Test_Deck_Handle_AssertExits(t *testing.T) {
+	at := assert.New(t)
+
+	tb := &fakeTB{name: "owner"}
+	defer tb.cleanup()
+
+	d := New(tb)
+	at.True(d.AssertExits(1, func() { OsExit(1) }))
+	at.False(d.AssertExits(1, func() {}))
+	at.Contains(tb.fatal, "deck: OsExit was not called")
+
+	at.Panics(func() { AssertExits(t, 1, func() { OsExit(1) }) })
+}
+
+func Test_Deck_Handle_Redirect(t *testing.T) {
+	at := assert.New(t)
+
+	tb := &fakeTB{name: "owner"}
+	d := New(tb)
+
+	d.RedirectStdout()
+	d.RedirectStderr()
+
+	_, _ = fmt.Fprint(Stdout, "stdout")
+	_, _ = fmt.Fprint(Stderr, "stderr")
+
+	at.Equal("stdout", d.DumpStdout())
+	at.Equal("", d.DumpStdout())
+	at.Equal(os.Stdout, Stdout)
+
+	at.Panics(RedirectStderr)
+
+	tb.cleanup()
+
+	at.Equal(os.Stderr, Stderr)
+}
+
+func Test_Deck_Handle_RestoreEveryClaim(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("capture then redirect", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		d := New(tb)
+
+		_, _ = d.CaptureOutput(func() {})
+		d.RedirectStdout()
+		at.NotEqual(os.Stdout, Stdout)
+
+		tb.cleanup()
+		at.Equal(os.Stdout, Stdout)
+	})
+
+	t.Run("envs then shims", func(t *testing.T) {
+		path := os.Getenv("PATH")
+
+		tb := &fakeTB{name: "owner"}
+		d := New(tb)
+
+		d.SetupEnvs(Envs{"PATH": path + string(os.PathListSeparator) + "deck"})
+		dir := d.SetupShims("git")
+		at.Empty(tb.fatal)
+
+		tb.cleanup()
+
+		at.Equal(path, os.Getenv("PATH"))
+		_, err := os.Stat(dir)
+		at.True(os.IsNotExist(err))
+	})
+
+	t.Run("console twice", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		d := New(tb)
+
+		first := d.SetupConsole()
+		second := d.SetupConsole()
+		at.NotNil(first)
+		at.NotNil(second)
+		at.NotNil(first.Send("x"))
+
+		_, _ = fmt.Fprint(Stdout, "second")
+
+		tb.cleanup()
+
+		at.Equal(os.Stdin, Stdin)
+		at.Equal(os.Stdout, Stdout)
+		at.Equal("second", second.Output())
+		// the closed console can't be written any more.
+		at.NotNil(second.Send("x"))
+	})
+}
+
+func Test_Deck_Handle_SetupEnvs(t *testing.T) {
+	at := assert.New(t)
+
+	key1 := "DAWN_DECK_HANDLE"
+	key2 := "DAWN_DECK_HANDLE2"
+
+	at.Nil(os.Setenv(key1, "1"))
+	defer func() { _ = os.Unsetenv(key1) }()
+
+	tb := &fakeTB{name: "owner"}
+	d := New(tb)
+	d.SetupEnvs(Envs{key1: "2", key2: "2"})
+
+	at.Equal("2", os.Getenv(key1))
+	at.Equal("2", os.Getenv(key2))
+
+	at.Panics(func() { SetupEnvs(Envs{key2: "3"}) })
+
+	other := &fakeTB{name: "other"}
+	New(other).SetupEnvs(Envs{key1: "3"})
+	at.Equal("deck: env DAWN_DECK_HANDLE is already mocked by owner", other.fatal)
+
+	d.UnsetEnvs(key1)
+	_, ok := os.LookupEnv(key1)
+	at.False(ok)
+	d.SetupEnvs(Envs{key1: "4"})
+	at.Equal("4", os.Getenv(key1))
+
+	tb.cleanup()
+
+	at.Equal("1", os.Getenv(key1))
+	_, ok = os.LookupEnv(key2)
+	at.False(ok)
+}
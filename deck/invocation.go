@@ -0,0 +1,253 @@
+package deck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Invocation is a record of a faked command which was run.
+type Invocation struct {
+	// Name is the command name
+	Name string
+	// Args are the command arguments
+	Args []string
+	// Env is the environment the command saw
+	Env []string
+	// Dir is the working directory of the command
+	Dir string
+	// Stdin is everything the caller wrote to the command's stdin
+	// before the command exited
+	Stdin string
+}
+
+// Call matches invocations of command Name whose args
+// are matched by Args. A nil Args matches any args.
+type Call struct {
+	Name string
+	Args ArgsMatcher
+}
+
+func (c Call) match(inv Invocation) bool {
+	return inv.Name == c.Name && (c.Args == nil || c.Args(inv.Args))
+}
+
+func (c Call) String() string {
+	return c.Name
+}
+
+type invocationRecord struct {
+	Env   []string `json:"env"`
+	Dir   string   `json:"dir"`
+	Start int64    `json:"start"`
+}
+
+// Invocations gets all faked commands which were run since
+// SetupCmd in the order they started. They are cleared by
+// TeardownCmd.
+func Invocations() []Invocation {
+	return defaultCommander.invocations()
+}
+
+// FindInvocations gets invocations matched by call.
+func FindInvocations(c Call) []Invocation {
+	return findInvocations(Invocations(), c)
+}
+
+func findInvocations(invs []Invocation, c Call) []Invocation {
+	var found []Invocation
+	for _, inv := range invs {
+		if c.match(inv) {
+			found = append(found, inv)
+		}
+	}
+	return found
+}
+
+// AssertCalled asserts a faked command matched by call was run.
+func AssertCalled(t testing.TB, c Call) bool {
+	t.Helper()
+	return assertCalled(t, Invocations(), c)
+}
+
+// AssertCalledTimes asserts a faked command matched by call
+// was run exactly times.
+func AssertCalledTimes(t testing.TB, times int, c Call) bool {
+	t.Helper()
+	return assertCalledTimes(t, Invocations(), times, c)
+}
+
+// AssertCalledOnce asserts a faked command matched by call
+// was run exactly once.
+func AssertCalledOnce(t testing.TB, c Call) bool {
+	t.Helper()
+	return assertCalledTimes(t, Invocations(), 1, c)
+}
+
+// AssertNotCalled asserts no faked command matched by call was run.
+func AssertNotCalled(t testing.TB, c Call) bool {
+	t.Helper()
+	return assertCalledTimes(t, Invocations(), 0, c)
+}
+
+// AssertCalledInOrder asserts faked commands matched by calls
+// were run in the given order. Other invocations may happen
+// between them.
+func AssertCalledInOrder(t testing.TB, calls ...Call) bool {
+	t.Helper()
+	return assertCalledInOrder(t, Invocations(), calls...)
+}
+
+func assertCalled(t assert.TestingT, invs []Invocation, c Call) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return assert.Truef(t, len(findInvocations(invs, c)) > 0,
+		"%s was not called, invocations:\n%s", c, formatInvocations(invs))
+}
+
+func assertCalledTimes(t assert.TestingT, invs []Invocation, times int, c Call) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return assert.Equalf(t, times, len(findInvocations(invs, c)),
+		"%s was not called %d time(s), invocations:\n%s", c, times, formatInvocations(invs))
+}
+
+func assertCalledInOrder(t assert.TestingT, invs []Invocation, calls ...Call) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	i := 0
+	for _, inv := range invs {
+		if i < len(calls) && calls[i].match(inv) {
+			i++
+		}
+	}
+
+	return assert.Truef(t, i == len(calls),
+		"%s was not called in order, invocations:\n%s", calls, formatInvocations(invs))
+}
+
+func formatInvocations(invs []Invocation) string {
+	var b strings.Builder
+	for i, inv := range invs {
+		_, _ = fmt.Fprintf(&b, "\t%d: %s %s\n", i+1, inv.Name, strings.Join(inv.Args, " "))
+	}
+	return b.String()
+}
+
+// recordInvocation saves environment of a helper process.
+func recordInvocation(base string) {
+	if base == "" {
+		return
+	}
+
+	dir, _ := os.Getwd()
+	r := invocationRecord{
+		Env:   os.Environ(),
+		Dir:   dir,
+		Start: time.Now().UnixNano(),
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(base+".json", b, 0600)
+}
+
+// stdinGrace is how long a helper process which is done waits
+// for the caller to close stdin, so stdin written right before
+// is still recorded.
+const stdinGrace = 100 * time.Millisecond
+
+// stdinRecorder reads stdin of a helper process in background and
+// saves everything the caller writes, no matter how much of it the
+// command reads. The command reads stdin from its buffer.
+type stdinRecorder struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// recordStdin starts recording stdin of a helper process.
+func recordStdin(base string) *stdinRecorder {
+	r := &stdinRecorder{done: make(chan struct{})}
+	r.cond = sync.NewCond(&r.mu)
+
+	var f *os.File
+	if base != "" {
+		f, _ = os.OpenFile(filepath.Clean(base+".stdin"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	}
+
+	go func() {
+		var w io.Writer = r
+		if f != nil {
+			w = io.MultiWriter(f, r)
+		}
+		_, err := io.Copy(w, os.Stdin)
+		if f != nil {
+			_ = f.Close()
+		}
+		if err == nil {
+			err = io.EOF
+		}
+
+		r.mu.Lock()
+		r.err = err
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		close(r.done)
+	}()
+
+	return r
+}
+
+func (r *stdinRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, _ := r.buf.Write(p)
+	r.cond.Broadcast()
+	return n, nil
+}
+
+func (r *stdinRecorder) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.buf.Len() == 0 && r.err == nil {
+		r.cond.Wait()
+	}
+
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+	return 0, r.err
+}
+
+// wait waits for the caller to close stdin, but no longer than
+// stdinGrace, so the command exits when it is done even if the
+// caller keeps stdin open.
+func (r *stdinRecorder) wait() {
+	select {
+	case <-r.done:
+	case <-time.After(stdinGrace):
+	}
+}
@@ -0,0 +1,80 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Invocation_Record(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("kubectl", ArgsPrefix("apply")).Stdout("applied")
+
+	dir, err := ioutil.TempDir("", "deck-invocation")
+	at.Nil(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	apply := ExecCommand("kubectl", "apply", "-f", "-")
+	apply.Stdin = strings.NewReader("kind: Pod")
+	apply.Dir = dir
+	apply.Env = append(os.Environ(), "DAWN_DECK_INVOCATION=1")
+	at.Nil(apply.Run())
+
+	at.Nil(ExecCommand("kubectl", "rollout", "status").Run())
+
+	_ = ExecCommand("kubectl", "delete")
+
+	invs := Invocations()
+	at.Len(invs, 2)
+	at.Equal("kubectl", invs[0].Name)
+	at.Equal([]string{"apply", "-f", "-"}, invs[0].Args)
+	at.Equal("kind: Pod", invs[0].Stdin)
+	at.Equal(evalDir(t, dir), evalDir(t, invs[0].Dir))
+	at.Contains(invs[0].Env, "DAWN_DECK_INVOCATION=1")
+	at.Equal([]string{"rollout", "status"}, invs[1].Args)
+
+	at.Len(FindInvocations(Call{Name: "kubectl"}), 2)
+	at.Len(FindInvocations(Call{Name: "kubectl", Args: ArgsPrefix("rollout")}), 1)
+}
+
+func Test_Deck_Invocation_Assert(t *testing.T) {
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("kubectl", AnyArgs)
+
+	apply := Call{Name: "kubectl", Args: ArgsPrefix("apply")}
+	status := Call{Name: "kubectl", Args: Args("rollout", "status")}
+	del := Call{Name: "kubectl", Args: ArgsPrefix("delete")}
+
+	assert.Nil(t, ExecCommand("kubectl", "apply", "-f", "a.yaml").Run())
+	assert.Nil(t, ExecCommand("kubectl", "rollout", "status").Run())
+
+	AssertCalled(t, apply)
+	AssertCalledOnce(t, status)
+	AssertCalledTimes(t, 2, Call{Name: "kubectl"})
+	AssertNotCalled(t, del)
+	AssertCalledInOrder(t, apply, status)
+
+	tb := &fakeTB{}
+	assert.False(t, AssertCalled(tb, del))
+	assert.Contains(t, tb.fatal, "was not called")
+	assert.False(t, AssertCalledOnce(tb, Call{Name: "kubectl"}))
+	assert.False(t, AssertNotCalled(tb, apply))
+	assert.False(t, AssertCalledInOrder(tb, status, apply))
+	assert.Contains(t, tb.fatal, "was not called in order")
+}
+
+func evalDir(t *testing.T, dir string) string {
+	d, err := filepath.EvalSymlinks(dir)
+	assert.Nil(t, err)
+	return d
+}
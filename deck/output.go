@@ -0,0 +1,118 @@
+package deck
+
+import (
+	"os"
+	"strings"
+)
+
+// Output is everything written to Stdout and Stderr while a
+// function runs in CaptureOutput.
+type Output struct {
+	// Stdout is the output to Stdout
+	Stdout string
+	// Stderr is the output to Stderr
+	Stderr string
+	// Chunks is the output to both in the order of writes, and
+	// adjacent writes to the same stream are joined
+	Chunks []Chunk
+}
+
+// Combined gets the output to both streams in the order of writes,
+// with every line of stderr prefixed by "[stderr] " and every line
+// of stdout prefixed by "[stdout] ".
+func (o Output) Combined() string {
+	var b strings.Builder
+	for _, c := range o.Chunks {
+		label := "[stdout] "
+		if c.Stderr {
+			label = "[stderr] "
+		}
+		for _, line := range strings.SplitAfter(c.Data, "\n") {
+			if line != "" {
+				b.WriteString(label + line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// CaptureOutput runs fn with Stdout and Stderr redirected and gets
+// what is written to them. Both streams send every write as a
+// datagram to the same socket, so chunks are in the real order of
+// writes, but a single write of more than 200KB may fail. It is only
+// supported on Linux.
+func CaptureOutput(fn func()) (Output, error) {
+	own(mockNameStdout, mockNameStderr)
+	defer disown(mockNameStdout, mockNameStderr)
+
+	return captureOutput(fn)
+}
+
+// CaptureOutput is like the package level CaptureOutput, but
+// Stdout and Stderr are claimed by the Deck for the rest of the
+// test rather than only while fn runs.
+func (d *Deck) CaptureOutput(fn func()) (Output, error) {
+	d.t.Helper()
+
+	if !d.claim(mockNameStdout, nil) || !d.claim(mockNameStderr, nil) {
+		return Output{}, nil
+	}
+
+	return captureOutput(fn)
+}
+
+func captureOutput(fn func()) (o Output, err error) {
+	r, err := newOutputRecorder()
+	if err != nil {
+		return
+	}
+
+	oldStdout, oldStderr := Stdout, Stderr
+	Stdout, Stderr = r.stdout, r.stderr
+
+	defer func() {
+		Stdout, Stderr = oldStdout, oldStderr
+
+		var chunks []Chunk
+		if chunks, err = r.close(); err == nil {
+			o = newOutput(chunks)
+		}
+	}()
+
+	fn()
+
+	return
+}
+
+// newOutput gets Output of chunks, joining adjacent chunks of the
+// same stream.
+func newOutput(chunks []Chunk) Output {
+	var o Output
+	var stdout, stderr strings.Builder
+
+	for _, c := range chunks {
+		if c.Stderr {
+			stderr.WriteString(c.Data)
+		} else {
+			stdout.WriteString(c.Data)
+		}
+
+		if n := len(o.Chunks); n > 0 && o.Chunks[n-1].Stderr == c.Stderr {
+			o.Chunks[n-1].Data += c.Data
+			continue
+		}
+		o.Chunks = append(o.Chunks, Chunk{Stderr: c.Stderr, Data: c.Data})
+	}
+
+	o.Stdout, o.Stderr = stdout.String(), stderr.String()
+
+	return o
+}
+
+// outputRecorder records writes to stdout and stderr in order.
+type outputRecorder struct {
+	stdout *os.File
+	stderr *os.File
+	// close stops recording and gets recorded chunks.
+	close func() ([]Chunk, error)
+}
@@ -0,0 +1,137 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// outputMaxWrite is the send buffer asked for Stdout and Stderr,
+// which limits the size of a single write. Linux doubles it, but
+// caps it by net.core.wmem_max, which is about 200KB by default.
+const outputMaxWrite = 256 << 10
+
+// newOutputRecorder gets a recorder whose stdout and stderr are
+// datagram sockets connected to the same socket. Writes to both
+// are queued in one receive queue, so the order of writes across
+// streams is kept, and the sender of every datagram tells its
+// stream.
+func newOutputRecorder() (r *outputRecorder, err error) {
+	dir, err := ioutil.TempDir("", "deck-output")
+	if err != nil {
+		return nil, err
+	}
+
+	var fds []int
+	defer func() {
+		if err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	socket := func(name string, peer *unix.SockaddrUnix) (*unix.SockaddrUnix, int, error) {
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		fds = append(fds, fd)
+
+		addr := &unix.SockaddrUnix{Name: filepath.Join(dir, name)}
+		if err = unix.Bind(fd, addr); err != nil {
+			return nil, 0, err
+		}
+
+		if peer != nil {
+			if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, outputMaxWrite); err != nil {
+				return nil, 0, err
+			}
+			if err = unix.Connect(fd, peer); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		return addr, fd, nil
+	}
+
+	recvAddr, recv, err := socket("recv", nil)
+	if err != nil {
+		return nil, err
+	}
+	stdoutAddr, stdout, err := socket("stdout", recvAddr)
+	if err != nil {
+		return nil, err
+	}
+	stderrAddr, stderr, err := socket("stderr", recvAddr)
+	if err != nil {
+		return nil, err
+	}
+	// a datagram from end is queued after all writes to stdout and
+	// stderr, and stops reading.
+	endAddr, end, err := socket("end", recvAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	done := make(chan error, 1)
+	go func() {
+		// the kernel doubles the send buffer of senders.
+		buf := make([]byte, 2*outputMaxWrite)
+		for {
+			n, from, err := unix.Recvfrom(recv, buf, 0)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+
+			sa, ok := from.(*unix.SockaddrUnix)
+			if !ok {
+				continue
+			}
+
+			switch sa.Name {
+			case stdoutAddr.Name:
+				chunks = append(chunks, Chunk{Data: string(buf[:n])})
+			case stderrAddr.Name:
+				chunks = append(chunks, Chunk{Stderr: true, Data: string(buf[:n])})
+			case endAddr.Name:
+				done <- nil
+				return
+			}
+		}
+	}()
+
+	r = &outputRecorder{
+		stdout: os.NewFile(uintptr(stdout), "stdout"),
+		stderr: os.NewFile(uintptr(stderr), "stderr"),
+	}
+
+	r.close = func() ([]Chunk, error) {
+		_ = r.stdout.Close()
+		_ = r.stderr.Close()
+
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		_, err := unix.Write(end, []byte{0})
+		_ = unix.Close(end)
+		if err != nil {
+			// recv is left open, since it is still being read.
+			return nil, err
+		}
+
+		err = <-done
+		_ = unix.Close(recv)
+
+		return chunks, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package deck
+
+import "errors"
+
+// newOutputRecorder is only supported on Linux.
+func newOutputRecorder() (*outputRecorder, error) {
+	return nil, errors.New("deck: capturing output in order is only supported on linux")
+}
@@ -0,0 +1,114 @@
+package deck
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Output_CaptureOutput(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		_, err := CaptureOutput(func() {})
+		assert.NotNil(t, err)
+		t.Skip("output is only captured in order on linux")
+	}
+
+	at := assert.New(t)
+
+	t.Run("order", func(t *testing.T) {
+		o, err := CaptureOutput(func() {
+			_, _ = fmt.Fprint(Stdout, "checking\n")
+			_, _ = fmt.Fprint(Stderr, "warning: deprecated\n")
+			_, _ = fmt.Fprint(Stdout, "summary\n")
+			_, _ = fmt.Fprint(Stdout, "done\n")
+		})
+
+		at.Nil(err)
+		at.Equal("checking\nsummary\ndone\n", o.Stdout)
+		at.Equal("warning: deprecated\n", o.Stderr)
+		at.Equal([]Chunk{
+			{Data: "checking\n"},
+			{Stderr: true, Data: "warning: deprecated\n"},
+			{Data: "summary\ndone\n"},
+		}, o.Chunks)
+		at.Equal("[stdout] checking\n[stderr] warning: deprecated\n[stdout] summary\n[stdout] done\n",
+			o.Combined())
+	})
+
+	t.Run("interleaved", func(t *testing.T) {
+		var want strings.Builder
+		o, err := CaptureOutput(func() {
+			for i := 0; i < 1000; i++ {
+				if i%3 == 0 {
+					_, _ = fmt.Fprintf(Stderr, "%d\n", i)
+					_, _ = fmt.Fprintf(&want, "[stderr] %d\n", i)
+				} else {
+					_, _ = fmt.Fprintf(Stdout, "%d\n", i)
+					_, _ = fmt.Fprintf(&want, "[stdout] %d\n", i)
+				}
+			}
+		})
+
+		at.Nil(err)
+		at.Equal(want.String(), o.Combined())
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		o, err := CaptureOutput(func() {
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						_, _ = fmt.Fprint(Stdout, "out\n")
+						_, _ = fmt.Fprint(Stderr, "err\n")
+					}
+				}()
+			}
+			wg.Wait()
+		})
+
+		at.Nil(err)
+		at.Equal(strings.Repeat("out\n", 1000), o.Stdout)
+		at.Equal(strings.Repeat("err\n", 1000), o.Stderr)
+	})
+
+	t.Run("large output", func(t *testing.T) {
+		large := strings.Repeat("deck", 1<<14)
+		o, err := CaptureOutput(func() {
+			for i := 0; i < 16; i++ {
+				_, _ = fmt.Fprint(Stdout, large)
+			}
+		})
+
+		at.Nil(err)
+		at.Equal(strings.Repeat(large, 16), o.Stdout)
+	})
+
+	t.Run("too large write", func(t *testing.T) {
+		var werr error
+		_, err := CaptureOutput(func() { _, werr = fmt.Fprint(Stdout, strings.Repeat("deck", 1<<18)) })
+		at.Nil(err)
+		at.NotNil(werr)
+	})
+
+	t.Run("restore on panic", func(t *testing.T) {
+		old := Stdout
+		at.Panics(func() { _, _ = CaptureOutput(func() { panic("boom") }) })
+		at.Equal(old, Stdout)
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		d := New(t)
+		o, err := d.CaptureOutput(func() { _, _ = fmt.Fprint(Stderr, "deck") })
+		at.Nil(err)
+		at.Equal("deck", o.Stderr)
+
+		at.Panics(func() { _, _ = CaptureOutput(func() {}) })
+	})
+}
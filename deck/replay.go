@@ -0,0 +1,207 @@
+package deck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// transcriptEntry is a command recorded in a transcript file.
+type transcriptEntry struct {
+	Name     string   `json:"name"`
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// transcript records real commands into a file, or replays
+// commands recorded in it.
+type transcript struct {
+	file      string
+	recording bool
+	entries   []transcriptEntry
+	used      []bool
+}
+
+// loadTranscript loads a transcript file. The transcript is in
+// recording mode if the file does not exist or should be updated.
+func loadTranscript(file string) (*transcript, error) {
+	tr := &transcript{file: fixturePath(file)}
+
+	b, err := ioutil.ReadFile(filepath.Clean(file))
+	if os.IsNotExist(err) || (err == nil && shouldUpdate()) {
+		tr.recording = true
+		return tr, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &tr.entries); err != nil {
+		return nil, fmt.Errorf("deck: invalid transcript %s: %w", file, err)
+	}
+	tr.used = make([]bool, len(tr.entries))
+
+	return tr, nil
+}
+
+// spec gets a stub spec which replays the first unused entry
+// matching name and args. The last matching entry is reused if
+// all of them are used.
+func (tr *transcript) spec(name string, args []string) stubSpec {
+	found := -1
+	for i, e := range tr.entries {
+		if e.Name != name || !Args(e.Args...)(args) {
+			continue
+		}
+		found = i
+		if !tr.used[i] {
+			break
+		}
+	}
+
+	if found == -1 {
+		msg := fmt.Sprintf("deck: %s %s is not recorded in %s",
+			name, strings.Join(args, " "), tr.file)
+		return stubSpec{Steps: []stubStep{{Stream: streamStderr, Data: []byte(msg)}}, Code: 1}
+	}
+
+	tr.used[found] = true
+	e := tr.entries[found]
+
+	return stubSpec{
+		Steps: []stubStep{
+			{Stream: streamStdout, Data: []byte(e.Stdout)},
+			{Stream: streamStderr, Data: []byte(e.Stderr)},
+		},
+		Code: e.ExitCode,
+	}
+}
+
+// SetupCmdReplay mocks ExecCommand and ExecCommandContext with
+// a transcript file, usually under testdata. If the file does not
+// exist or the test runs with -deck.update, real commands are run
+// and recorded into the file by TeardownCmd. Otherwise commands
+// are replayed from the file. Stubs registered by OnCommand take
+// precedence over the transcript.
+func SetupCmdReplay(file string) {
+	checkNotOwned(mockNameExecCommand)
+
+	if err := defaultCommander.setupReplay(file); err != nil {
+		panic(err)
+	}
+
+	own(mockNameExecCommand)
+	mockExecCommand = defaultCommander.command
+	mockExecCommandContext = defaultCommander.commandContext
+}
+
+func (c *commander) setupReplay(file string) error {
+	tr, err := loadTranscript(file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expectError = false
+	c.expectStderr = false
+	c.transcript = tr
+
+	return nil
+}
+
+// saveTranscript writes recorded commands into the transcript
+// file if the commander is recording.
+func (c *commander) saveTranscript() error {
+	c.mu.Lock()
+	tr, calls := c.transcript, c.calls
+	c.mu.Unlock()
+
+	if tr == nil || !tr.recording {
+		return nil
+	}
+
+	entries := []transcriptEntry{}
+	for _, fc := range calls {
+		code, err := ioutil.ReadFile(fc.base + ".code")
+		if err != nil {
+			continue
+		}
+
+		e := transcriptEntry{Name: fc.name, Args: fc.args}
+		e.ExitCode, _ = strconv.Atoi(string(code))
+		stdout, _ := ioutil.ReadFile(fc.base + ".stdout")
+		e.Stdout = string(stdout)
+		stderr, _ := ioutil.ReadFile(fc.base + ".stderr")
+		e.Stderr = string(stderr)
+
+		entries = append(entries, e)
+	}
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(tr.file), 0750); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(tr.file, append(b, '\n'), 0600)
+}
+
+// recordCommand runs the real command in the helper process and
+// records its output and exit code next to base.
+func recordCommand(h helperArgs) int {
+	stdout, err := os.Create(filepath.Clean(h.base + ".stdout"))
+	if err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+	defer func() { _ = stdout.Close() }()
+
+	stderr, err := os.Create(filepath.Clean(h.base + ".stderr"))
+	if err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+	defer func() { _ = stderr.Close() }()
+
+	// stdin is passed to the real command as it is, otherwise Wait
+	// of the command would block until the caller closes stdin.
+	recordInvocation(h.base)
+
+	// shims on PATH would run the helper process again.
+	_ = os.Setenv("PATH", withoutShims(os.Getenv("PATH")))
+
+	cmd := exec.Command(h.args[0], h.args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(Stdout, stdout)
+	cmd.Stderr = io.MultiWriter(Stderr, stderr)
+
+	code := 0
+	if err = cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		} else {
+			_, _ = cmd.Stderr.Write([]byte("deck: " + err.Error()))
+			code = 127
+		}
+	}
+
+	if err = ioutil.WriteFile(h.base+".code", []byte(strconv.Itoa(code)), 0600); err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+
+	return code
+}
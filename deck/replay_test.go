@@ -0,0 +1,148 @@
+package deck
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Replay(t *testing.T) {
+	at := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "deck-replay")
+	at.Nil(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "testdata", "go.json")
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	t.Run("record", func(t *testing.T) {
+		SetupCmdReplay(file)
+
+		b, err := ExecCommand("go", "env", "GOOS").Output()
+		at.Nil(err)
+		at.Equal(runtime.GOOS, string(trimNewline(b)))
+
+		err = ExecCommand("go", "deck-not-exist").Run()
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		at.Equal(2, exitErr.ExitCode())
+
+		TeardownCmd()
+
+		entries := readTranscript(t, file)
+		at.Len(entries, 2)
+		at.Equal("go", entries[0].Name)
+		at.Equal([]string{"env", "GOOS"}, entries[0].Args)
+		at.Equal(runtime.GOOS, string(trimNewline([]byte(entries[0].Stdout))))
+		at.Equal(2, entries[1].ExitCode)
+		at.NotEmpty(entries[1].Stderr)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		entries := readTranscript(t, file)
+		entries[0].Stdout = "first"
+		entries = append(entries, transcriptEntry{Name: "go", Args: []string{"env", "GOOS"}, Stdout: "second"})
+		writeTranscript(t, file, entries)
+
+		SetupCmdReplay(file)
+		defer TeardownCmd()
+
+		for _, expected := range []string{"first", "second", "second"} {
+			b, err := ExecCommand("go", "env", "GOOS").Output()
+			at.Nil(err)
+			at.Equal(expected, string(b))
+		}
+
+		b, err := ExecCommand("go", "deck-not-exist").CombinedOutput()
+		at.NotNil(err)
+		at.Equal(entries[1].Stderr, string(b))
+
+		b, err = ExecCommand("go", "version").CombinedOutput()
+		at.NotNil(err)
+		at.Contains(string(b), "deck: go version is not recorded in")
+
+		AssertCalledTimes(t, 5, Call{Name: "go"})
+	})
+
+	t.Run("stub first", func(t *testing.T) {
+		SetupCmdReplay(file)
+		defer TeardownCmd()
+
+		OnCommand("go", AnyArgs).Stdout("stub")
+
+		b, err := ExecCommand("go", "env", "GOOS").Output()
+		at.Nil(err)
+		at.Equal("stub", string(b))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		*updateFlag = true
+		defer func() { *updateFlag = false }()
+
+		SetupCmdReplay(file)
+
+		b, err := ExecCommand("go", "env", "GOOS").Output()
+		at.Nil(err)
+		at.Equal(runtime.GOOS, string(trimNewline(b)))
+
+		TeardownCmd()
+
+		at.Len(readTranscript(t, file), 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		at.Nil(ioutil.WriteFile(file, []byte("invalid"), 0600))
+
+		at.Panics(func() { SetupCmdReplay(file) })
+	})
+
+	t.Run("handle", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		d := New(tb)
+
+		other := filepath.Join(dir, "other.json")
+		d.SetupCmdReplay(other)
+
+		b, err := ExecCommand("go", "env", "GOOS").Output()
+		at.Nil(err)
+		at.Equal(runtime.GOOS, string(trimNewline(b)))
+
+		tb.cleanup()
+
+		at.Len(readTranscript(t, other), 1)
+
+		d = New(tb)
+		d.SetupCmdReplay(file)
+		at.Contains(tb.fatal, "deck: invalid transcript")
+	})
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func readTranscript(t *testing.T, file string) (entries []transcriptEntry) {
+	b, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(b, &entries))
+	return
+}
+
+func writeTranscript(t *testing.T, file string, entries []transcriptEntry) {
+	b, err := json.Marshal(entries)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(file, b, 0600))
+}
@@ -0,0 +1,199 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// packageDir is the working directory when the test binary
+// starts, which go test sets to the directory of the package.
+var packageDir, _ = os.Getwd()
+
+// fixturePath resolves a relative path of a fixture, like a golden
+// file, tree archive, transcript or env file, against packageDir,
+// so that testdata is still found after SetupSandbox changes the
+// working directory.
+func fixturePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(packageDir, path)
+}
+
+// Sandbox is a fresh temporary tree which a test runs in, so that
+// it does not touch the working directory, home directory or
+// temporary files of the machine.
+type Sandbox struct {
+	// Root contains everything of the sandbox
+	Root string
+	// Dir is the working directory
+	Dir string
+	// Home is HOME, and USERPROFILE on Windows
+	Home string
+	// ConfigHome is XDG_CONFIG_HOME, and APPDATA on Windows
+	ConfigHome string
+	// DataHome is XDG_DATA_HOME
+	DataHome string
+	// CacheHome is XDG_CACHE_HOME, and LOCALAPPDATA on Windows
+	CacheHome string
+	// StateHome is XDG_STATE_HOME
+	StateHome string
+	// TempDir is TMPDIR, and TMP and TEMP on Windows
+	TempDir string
+}
+
+var defaultSandbox struct {
+	sandbox *Sandbox
+	oldDir  string
+	envs    envFrame
+}
+
+// SetupSandbox creates a Sandbox, changes the working directory
+// to its Dir and points HOME, XDG_* and TMPDIR to its directories
+// until TeardownSandbox is called.
+func SetupSandbox() *Sandbox {
+	checkNotOwned(mockNameWorkDir)
+
+	TeardownSandbox()
+
+	s, err := newSandbox()
+	if err != nil {
+		panic(err)
+	}
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		_ = os.RemoveAll(s.Root)
+		panic(err)
+	}
+
+	envs := s.envs()
+	keys := make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k)
+	}
+	frame := pushEnvFrame(keys)
+	own(mockNameWorkDir)
+
+	if err = os.Chdir(s.Dir); err != nil {
+		_ = os.RemoveAll(s.Root)
+		panic(err)
+	}
+	for k, v := range envs {
+		_ = os.Setenv(k, v)
+	}
+
+	defaultSandbox.sandbox, defaultSandbox.oldDir, defaultSandbox.envs = s, oldDir, frame
+
+	return s
+}
+
+// TeardownSandbox restores the working directory and envs
+// changed by SetupSandbox, and removes the Sandbox.
+func TeardownSandbox() {
+	if defaultSandbox.sandbox == nil {
+		return
+	}
+
+	_ = os.Chdir(defaultSandbox.oldDir)
+	popEnvFrame(defaultSandbox.envs)
+	disownAll(mockNameWorkDir)
+	_ = os.RemoveAll(defaultSandbox.sandbox.Root)
+
+	defaultSandbox.sandbox = nil
+}
+
+// SetupSandbox is like the package level SetupSandbox, but the
+// working directory and envs are restored and the Sandbox is
+// removed when the test ends instead of by TeardownSandbox.
+func (d *Deck) SetupSandbox() *Sandbox {
+	d.t.Helper()
+
+	s, err := newSandbox()
+	if err != nil {
+		d.t.Fatal(err)
+		return nil
+	}
+	d.t.Cleanup(func() { _ = os.RemoveAll(s.Root) })
+
+	oldDir, err := os.Getwd()
+	if err != nil {
+		d.t.Fatal(err)
+		return nil
+	}
+
+	if !d.claim(mockNameWorkDir, func() { _ = os.Chdir(oldDir) }) {
+		return nil
+	}
+
+	if err = os.Chdir(s.Dir); err != nil {
+		d.t.Fatal(err)
+		return nil
+	}
+
+	d.SetupEnvs(s.envs())
+
+	return s
+}
+
+func newSandbox() (*Sandbox, error) {
+	root, err := ioutil.TempDir("", "deck-sandbox")
+	if err != nil {
+		return nil, err
+	}
+
+	// the working directory is reported with symlinks resolved,
+	// e.g. /private/var instead of /var on macOS.
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	home := filepath.Join(root, "home")
+	s := &Sandbox{
+		Root:       root,
+		Dir:        filepath.Join(root, "work"),
+		Home:       home,
+		ConfigHome: filepath.Join(home, ".config"),
+		DataHome:   filepath.Join(home, ".local", "share"),
+		CacheHome:  filepath.Join(home, ".cache"),
+		StateHome:  filepath.Join(home, ".local", "state"),
+		TempDir:    filepath.Join(root, "tmp"),
+	}
+
+	for _, dir := range []string{s.Dir, s.ConfigHome, s.DataHome, s.CacheHome, s.StateHome, s.TempDir} {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			_ = os.RemoveAll(root)
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Sandbox) envs() Envs {
+	envs := Envs{
+		"HOME":            s.Home,
+		"XDG_CONFIG_HOME": s.ConfigHome,
+		"XDG_DATA_HOME":   s.DataHome,
+		"XDG_CACHE_HOME":  s.CacheHome,
+		"XDG_STATE_HOME":  s.StateHome,
+		"TMPDIR":          s.TempDir,
+	}
+
+	if runtime.GOOS == "windows" {
+		envs["USERPROFILE"] = s.Home
+		envs["APPDATA"] = s.ConfigHome
+		envs["LOCALAPPDATA"] = s.CacheHome
+		envs["TMP"] = s.TempDir
+		envs["TEMP"] = s.TempDir
+	}
+
+	return envs
+}
+
+// Path joins elem to Dir of the Sandbox.
+func (s *Sandbox) Path(elem ...string) string {
+	return filepath.Join(append([]string{s.Dir}, elem...)...)
+}
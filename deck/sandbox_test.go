@@ -0,0 +1,107 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Sandbox(t *testing.T) {
+	at := assert.New(t)
+
+	wd, err := os.Getwd()
+	at.Nil(err)
+	home := os.Getenv("HOME")
+
+	t.Run("legacy", func(t *testing.T) {
+		s := SetupSandbox()
+
+		dir, err := os.Getwd()
+		at.Nil(err)
+		at.Equal(s.Dir, dir)
+		at.Equal(s.Home, os.Getenv("HOME"))
+		at.Equal(s.ConfigHome, os.Getenv("XDG_CONFIG_HOME"))
+		at.Equal(s.TempDir, os.TempDir())
+
+		at.Nil(ioutil.WriteFile("out.txt", []byte("sandbox"), 0600))
+		b, err := ioutil.ReadFile(s.Path("out.txt"))
+		at.Nil(err)
+		at.Equal("sandbox", string(b))
+
+		f, err := ioutil.TempFile("", "deck")
+		at.Nil(err)
+		at.Equal(s.TempDir, filepath.Dir(f.Name()))
+		_ = f.Close()
+
+		TeardownSandbox()
+
+		dir, err = os.Getwd()
+		at.Nil(err)
+		at.Equal(wd, dir)
+		at.Equal(home, os.Getenv("HOME"))
+		_, err = os.Stat(s.Root)
+		at.True(os.IsNotExist(err))
+
+		TeardownSandbox()
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		tb := &fakeTB{name: "owner"}
+		s := New(tb).SetupSandbox()
+
+		dir, err := os.Getwd()
+		at.Nil(err)
+		at.Equal(s.Dir, dir)
+		at.Equal(s.StateHome, os.Getenv("XDG_STATE_HOME"))
+
+		at.Panics(func() { SetupSandbox() })
+
+		other := &fakeTB{name: "other"}
+		at.Nil(New(other).SetupSandbox())
+		at.Equal("deck: working directory is already mocked by owner", other.fatal)
+		other.cleanup()
+
+		tb.cleanup()
+
+		dir, err = os.Getwd()
+		at.Nil(err)
+		at.Equal(wd, dir)
+		at.Equal(home, os.Getenv("HOME"))
+		_, err = os.Stat(s.Root)
+		at.True(os.IsNotExist(err))
+	})
+}
+
+func Test_Deck_Sandbox_Fixtures(t *testing.T) {
+	at := assert.New(t)
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	d := New(t)
+	s := d.SetupSandbox()
+
+	// fixtures under testdata are found in the package directory.
+	envs, err := LoadEnvFile(filepath.Join("testdata", "envs", "app.env"))
+	at.Nil(err)
+	at.Equal("deck", envs["APP_NAME"])
+
+	at.Nil(WriteTree(s.Dir, filepath.Join("testdata", "tree", "in.txtar")))
+	at.True(d.AssertTree(s.Dir, filepath.Join("testdata", "tree", "in.txtar")))
+
+	at.Equal(filepath.Join(packageDir, "testdata", "golden", "usage.golden"), goldenFile("golden/usage"))
+
+	tr, err := loadTranscript(filepath.Join("testdata", "replay", "go.json"))
+	at.Nil(err)
+	at.Equal(filepath.Join(packageDir, "testdata", "replay", "go.json"), tr.file)
+
+	// files of the sandbox are still found by absolute paths.
+	at.Nil(ioutil.WriteFile(s.Path("app.env"), []byte("APP_NAME=sandbox"), 0600))
+	envs, err = LoadEnvFile(s.Path("app.env"))
+	at.Nil(err)
+	at.Equal("sandbox", envs["APP_NAME"])
+}
@@ -0,0 +1,283 @@
+package deck
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// shimMarker is a file in every shim directory, so that real
+// commands recorded by SetupCmdReplay skip the directory. It holds
+// the address of the test process and the token of shims.
+const shimMarker = ".deck-shims"
+
+// shims are executables in a temporary directory, which is put
+// first on PATH. Every shim starts a helper process, which asks
+// the commander of the test process how to serve the command.
+// Shims read a random token from the shim marker, which only the
+// user can read, so that other processes which connect to the
+// listener are not served.
+type shims struct {
+	dir     string
+	oldPath string
+	ln      net.Listener
+	token   string
+}
+
+type shimRequest struct {
+	Token string   `json:"token"`
+	Args  []string `json:"args"`
+}
+
+type shimResponse struct {
+	Base         string `json:"base"`
+	Stub         bool   `json:"stub"`
+	Record       bool   `json:"record"`
+	ExpectStderr bool   `json:"expect_stderr"`
+}
+
+var defaultShims *shims
+
+// SetupShims creates shim executables of names in a temporary
+// directory and puts it first on PATH, so that processes which do
+// not use ExecCommand, like third-party libraries or child scripts,
+// also run faked commands. Shims are served like ExecCommand mocked
+// by SetupCmd: by stubs registered by OnCommand, transcripts of
+// SetupCmdReplay or TestHelperCommand, and they are recorded as
+// invocations. It returns the shim directory.
+func SetupShims(names ...string) string {
+	checkNotOwned(mockNameEnv + "PATH")
+
+	if defaultShims != nil {
+		TeardownShims()
+	}
+
+	s, err := newShims(defaultCommander, names)
+	if err != nil {
+		panic(err)
+	}
+	defaultShims = s
+	own(mockNameEnv + "PATH")
+
+	return s.dir
+}
+
+// TeardownShims removes shims and restores PATH.
+func TeardownShims() {
+	if defaultShims != nil {
+		defaultShims.close()
+		defaultShims = nil
+		disown(mockNameEnv + "PATH")
+	}
+}
+
+// SetupShims is like the package level SetupShims, but shims are
+// served by stubs and invocations of the Deck instead of package
+// level ones, and they are removed when the test ends. Calling it
+// again replaces the previous shims.
+func (d *Deck) SetupShims(names ...string) string {
+	d.t.Helper()
+
+	var s *shims
+	restore := func() {
+		if s != nil {
+			s.close()
+		}
+		if d.shims == s {
+			d.shims = nil
+		}
+	}
+
+	if !d.claim(mockNameEnv+"PATH", restore) {
+		return ""
+	}
+
+	if d.shims != nil {
+		d.shims.close()
+		d.shims = nil
+	}
+
+	var err error
+	if s, err = newShims(d.cmd, names); err != nil {
+		d.t.Fatal(err)
+		return ""
+	}
+	d.shims = s
+
+	return s.dir
+}
+
+func newShims(c *commander, names []string) (s *shims, err error) {
+	s = &shims{oldPath: os.Getenv("PATH")}
+
+	if s.token, err = newShimToken(); err != nil {
+		return nil, err
+	}
+
+	if s.dir, err = ioutil.TempDir("", "deck-shims"); err != nil {
+		return nil, err
+	}
+
+	if s.ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		_ = os.RemoveAll(s.dir)
+		return nil, err
+	}
+
+	go s.serve(c)
+
+	if err = s.write(names); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	_ = os.Setenv("PATH", s.dir+string(os.PathListSeparator)+s.oldPath)
+
+	return s, nil
+}
+
+func newShimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *shims) write(names []string) error {
+	marker := filepath.Join(s.dir, shimMarker)
+	if err := ioutil.WriteFile(marker, []byte(s.ln.Addr().String()+"\n"+s.token), 0600); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		h := helperArgs{base: marker, shim: true, args: []string{name}}
+		args := append([]string{helperBinary()}, h.build()...)
+
+		file, content := filepath.Join(s.dir, name), shimScript(args)
+		if runtime.GOOS == "windows" {
+			file += ".bat"
+		}
+
+		// #nosec G306 shims must be executable
+		if err := ioutil.WriteFile(file, []byte(content), 0700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shimScript gets content of a shim which runs args with
+// args of the shim appended.
+func shimScript(args []string) string {
+	if runtime.GOOS == "windows" {
+		for i, arg := range args {
+			args[i] = `"` + arg + `"`
+		}
+		return "@" + strings.Join(args, " ") + " %*\r\n"
+	}
+
+	for i, arg := range args {
+		args[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return "#!/bin/sh\nexec " + strings.Join(args, " ") + ` "$@"` + "\n"
+}
+
+func (s *shims) serve(c *commander) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer func() { _ = conn.Close() }()
+
+			var req shimRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil || len(req.Args) == 0 {
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.token)) != 1 {
+				return
+			}
+
+			c.mu.Lock()
+			expectStderr := c.expectStderr
+			c.mu.Unlock()
+
+			h := c.resolve(req.Args[0], req.Args[1:], expectStderr)
+
+			_ = json.NewEncoder(conn).Encode(shimResponse{
+				Base:         h.base,
+				Stub:         h.stub,
+				Record:       h.record,
+				ExpectStderr: h.expectStderr,
+			})
+		}()
+	}
+}
+
+func (s *shims) close() {
+	_ = s.ln.Close()
+	_ = os.Setenv("PATH", s.oldPath)
+	_ = os.RemoveAll(s.dir)
+}
+
+// resolveShim asks the test process how to serve the command run
+// by a shim. h.base is the shim marker, which holds the address
+// of the test process and the token on separate lines.
+func resolveShim(h helperArgs) (helperArgs, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(h.base))
+	if err != nil {
+		return h, err
+	}
+
+	lines := strings.SplitN(string(b), "\n", 2)
+	if len(lines) != 2 {
+		return h, errors.New("invalid shim marker " + h.base)
+	}
+
+	conn, err := net.Dial("tcp", lines[0])
+	if err != nil {
+		return h, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	req := shimRequest{Token: lines[1], Args: h.args}
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return h, err
+	}
+
+	var resp shimResponse
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return h, err
+	}
+
+	return helperArgs{
+		base:         resp.Base,
+		stub:         resp.Stub,
+		record:       resp.Record,
+		expectStderr: resp.ExpectStderr,
+		args:         h.args,
+	}, nil
+}
+
+// withoutShims gets PATH without shim directories.
+func withoutShims(path string) string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(path) {
+		if _, err := os.Stat(filepath.Join(dir, shimMarker)); err != nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
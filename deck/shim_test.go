@@ -0,0 +1,145 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Shim_SetupShims(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shims are scripts run by sh")
+	}
+
+	at := assert.New(t)
+
+	path := os.Getenv("PATH")
+
+	dir := SetupShims("git", "kubectl")
+	defer TeardownCmd()
+
+	OnCommand("git", Args("status")).Stdout("clean")
+
+	at.True(strings.HasPrefix(os.Getenv("PATH"), dir))
+
+	bin, err := exec.LookPath("git")
+	at.Nil(err)
+	at.Equal(filepath.Join(dir, "git"), bin)
+
+	b, err := exec.Command("git", "status").Output()
+	at.Nil(err)
+	at.Equal("clean", string(b))
+
+	b, err = exec.Command("sh", "-c", "kubectl apply -f 'it'\\''s.yaml'").Output()
+	at.Nil(err)
+	at.Equal("[kubectl apply -f it's.yaml]", string(b))
+
+	AssertCalledInOrder(t,
+		Call{Name: "git", Args: Args("status")},
+		Call{Name: "kubectl", Args: Args("apply", "-f", "it's.yaml")})
+
+	old := dir
+	dir = SetupShims("helm")
+	at.NotContains(os.Getenv("PATH"), old)
+
+	TeardownShims()
+
+	at.Equal(path, os.Getenv("PATH"))
+	_, err = os.Stat(dir)
+	at.True(os.IsNotExist(err))
+}
+
+func Test_Deck_Shim_Handle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shims are scripts run by sh")
+	}
+
+	at := assert.New(t)
+
+	path := os.Getenv("PATH")
+
+	tb := &fakeTB{name: "owner"}
+	d := New(tb)
+
+	old := d.SetupShims("docker")
+	d.SetupShims("git")
+	d.OnCommand("git", AnyArgs).Stderr("fatal").Exit(128)
+
+	_, err := os.Stat(old)
+	at.True(os.IsNotExist(err))
+	at.NotContains(os.Getenv("PATH"), old)
+
+	b, err := exec.Command("git", "push").CombinedOutput()
+	at.Equal("fatal", string(b))
+	exitErr, ok := err.(*exec.ExitError)
+	at.True(ok)
+	at.Equal(128, exitErr.ExitCode())
+	d.AssertCalledOnce(Call{Name: "git", Args: Args("push")})
+
+	at.Panics(func() { SetupShims("git") })
+
+	tb.cleanup()
+
+	at.Equal(path, os.Getenv("PATH"))
+}
+
+func Test_Deck_Shim_WithoutShims(t *testing.T) {
+	at := assert.New(t)
+
+	dir := SetupShims()
+	defer TeardownShims()
+
+	at.Equal(os.Getenv("PATH"), dir+string(os.PathListSeparator)+withoutShims(os.Getenv("PATH")))
+}
+
+func Test_Deck_Shim_ResolveShim(t *testing.T) {
+	_, err := resolveShim(helperArgs{base: "127.0.0.1:0"})
+	assert.NotNil(t, err)
+}
+
+func Test_Deck_Shim_Token(t *testing.T) {
+	at := assert.New(t)
+
+	s, err := newShims(&commander{}, []string{"git"})
+	at.Nil(err)
+	defer s.close()
+
+	marker := filepath.Join(s.dir, shimMarker)
+
+	h, err := resolveShim(helperArgs{base: marker, args: []string{"git"}})
+	at.Nil(err)
+	at.Equal([]string{"git"}, h.args)
+
+	// the token is not passed in args of shims.
+	file := filepath.Join(s.dir, "git")
+	if runtime.GOOS == "windows" {
+		file += ".bat"
+	}
+	script, err := ioutil.ReadFile(file)
+	at.Nil(err)
+	at.NotContains(string(script), s.token)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(marker)
+		at.Nil(err)
+		at.Equal(os.FileMode(0600), info.Mode().Perm())
+	}
+
+	invalid := filepath.Join(s.dir, "invalid")
+	at.Nil(ioutil.WriteFile(invalid, []byte(s.ln.Addr().String()+"\ninvalid"), 0600))
+	_, err = resolveShim(helperArgs{base: invalid, args: []string{"git"}})
+	at.NotNil(err)
+
+	at.Nil(ioutil.WriteFile(invalid, []byte(s.ln.Addr().String()), 0600))
+	_, err = resolveShim(helperArgs{base: invalid, args: []string{"git"}})
+	at.NotNil(err)
+
+	_, err = resolveShim(helperArgs{base: filepath.Join(s.dir, "not-exist"), args: []string{"git"}})
+	at.NotNil(err)
+}
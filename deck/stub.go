@@ -0,0 +1,325 @@
+package deck
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ArgsMatcher reports whether args of a faked command are matched.
+type ArgsMatcher func(args []string) bool
+
+// AnyArgs matches any args.
+func AnyArgs(_ []string) bool { return true }
+
+// Args matches args exactly.
+func Args(expected ...string) ArgsMatcher {
+	return func(args []string) bool {
+		if len(args) != len(expected) {
+			return false
+		}
+		for i := range args {
+			if args[i] != expected[i] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ArgsPrefix matches args starting with prefix.
+func ArgsPrefix(prefix ...string) ArgsMatcher {
+	return func(args []string) bool {
+		return len(args) >= len(prefix) && Args(prefix...)(args[:len(prefix)])
+	}
+}
+
+// ArgsRegexp matches args joined by spaces with a regular expression.
+func ArgsRegexp(expr string) ArgsMatcher {
+	re := regexp.MustCompile(expr)
+	return func(args []string) bool {
+		return re.MatchString(strings.Join(args, " "))
+	}
+}
+
+// Stub is a scripted response of a faked command.
+type Stub struct {
+	name  string
+	match ArgsMatcher
+
+	// mu guards spec, which can be read by the shim server
+	// while a test is still scripting the stub.
+	mu   sync.Mutex
+	spec stubSpec
+}
+
+type stubSpec struct {
+	Steps      []stubStep   `json:"steps"`
+	Code       int          `json:"code"`
+	Signals    []stubSignal `json:"signals,omitempty"`
+	ExitSignal int          `json:"exit_signal,omitempty"`
+}
+
+const (
+	streamStdout = 1
+	streamStderr = 2
+)
+
+type stubStep struct {
+	Stream int           `json:"stream,omitempty"`
+	Data   []byte        `json:"data,omitempty"`
+	Delay  time.Duration `json:"delay,omitempty"`
+	Hang   bool          `json:"hang,omitempty"`
+}
+
+// stubSignal is how a stub handles a signal.
+type stubSignal struct {
+	Signal int        `json:"signal"`
+	Steps  []stubStep `json:"steps,omitempty"`
+	Code   int        `json:"code"`
+}
+
+// OnCommand registers a stub for command name whose args are
+// matched by match. When ExecCommand is mocked by SetupCmd,
+// the first registered stub matching a command serves it and
+// TestHelperCommand is not needed. Commands without a matching
+// stub still go to TestHelperCommand. Stubs are removed by
+// TeardownCmd.
+func OnCommand(name string, match ArgsMatcher) *Stub {
+	return defaultCommander.onCommand(name, match)
+}
+
+// Stdout makes the stub write out to stdout.
+func (s *Stub) Stdout(out string) *Stub {
+	return s.addStep(stubStep{Stream: streamStdout, Data: []byte(out)})
+}
+
+// Stderr makes the stub write out to stderr.
+func (s *Stub) Stderr(out string) *Stub {
+	return s.addStep(stubStep{Stream: streamStderr, Data: []byte(out)})
+}
+
+// Chunk is a piece of output written by a stub or captured by
+// CaptureOutput.
+type Chunk struct {
+	// Stderr makes Data written to stderr instead of stdout
+	Stderr bool
+	// Data is the output
+	Data string
+	// Delay is waited before writing Data
+	Delay time.Duration
+}
+
+// Stream makes the stub write chunks in order, each one after its
+// delay. Every chunk is written at once, so stdout and stderr are
+// interleaved the same way as chunks.
+func (s *Stub) Stream(chunks ...Chunk) *Stub {
+	for _, c := range chunks {
+		if c.Delay > 0 {
+			s.Delay(c.Delay)
+		}
+		if c.Stderr {
+			s.Stderr(c.Data)
+		} else {
+			s.Stdout(c.Data)
+		}
+	}
+	return s
+}
+
+// StdoutLines makes the stub write lines to stdout one by one,
+// waiting for interval before each line.
+func (s *Stub) StdoutLines(interval time.Duration, lines ...string) *Stub {
+	return s.lines(false, interval, lines)
+}
+
+// StderrLines makes the stub write lines to stderr one by one,
+// waiting for interval before each line.
+func (s *Stub) StderrLines(interval time.Duration, lines ...string) *Stub {
+	return s.lines(true, interval, lines)
+}
+
+func (s *Stub) lines(stderr bool, interval time.Duration, lines []string) *Stub {
+	for _, line := range lines {
+		s.Stream(Chunk{Stderr: stderr, Data: line + "\n", Delay: interval})
+	}
+	return s
+}
+
+// Delay makes the stub sleep for d before going on with
+// the following steps or exiting.
+func (s *Stub) Delay(d time.Duration) *Stub {
+	return s.addStep(stubStep{Delay: d})
+}
+
+// Hang makes the stub never exit until it is killed, which
+// is handy to test timeout and cancellation of a command
+// created by ExecCommandContext.
+func (s *Stub) Hang() *Stub {
+	return s.addStep(stubStep{Hang: true})
+}
+
+// Exit makes the stub exit with code.
+func (s *Stub) Exit(code int) *Stub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spec.Code = code
+	return s
+}
+
+// OnSignal makes the stub handle sig by writing chunks and exiting
+// with code, no matter which step it is at. Signals without a
+// handler take their default action, which usually kills the stub.
+// Handlers are installed before the first step, so the first output
+// of the stub tells a test it is ready for signals.
+func (s *Stub) OnSignal(sig syscall.Signal, code int, chunks ...Chunk) *Stub {
+	h := (&Stub{}).Stream(chunks...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spec.Signals = append(s.spec.Signals, stubSignal{
+		Signal: int(sig),
+		Steps:  h.spec.Steps,
+		Code:   code,
+	})
+	return s
+}
+
+// ExitBySignal makes the stub kill itself with sig after its steps
+// instead of exiting with a code, so the command reports that it is
+// terminated by sig, e.g. by Sys() of exec.ExitError. It is not
+// supported on Windows, where the stub exits with code 1.
+func (s *Stub) ExitBySignal(sig syscall.Signal) *Stub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spec.ExitSignal = int(sig)
+	return s
+}
+
+func (s *Stub) addStep(step stubStep) *Stub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spec.Steps = append(s.spec.Steps, step)
+	return s
+}
+
+// snapshot gets a copy of the spec of the stub.
+func (s *Stub) snapshot() stubSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spec := s.spec
+	spec.Steps = append([]stubStep(nil), s.spec.Steps...)
+	spec.Signals = append([]stubSignal(nil), s.spec.Signals...)
+	return spec
+}
+
+// writeStub writes a stub spec next to base for a helper
+// process to replay it.
+func writeStub(spec stubSpec, base string) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		panic(err)
+	}
+
+	if err = ioutil.WriteFile(base+".stub", b, 0600); err != nil {
+		panic(err)
+	}
+}
+
+// serveStub replays the stub spec next to base in the
+// helper process.
+func serveStub(base string) int {
+	b, err := ioutil.ReadFile(filepath.Clean(base + ".stub"))
+	if err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+
+	var spec stubSpec
+	if err = json.Unmarshal(b, &spec); err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+
+	recordInvocation(base)
+	stdin := recordStdin(base)
+
+	// mu keeps output of a signal handler from being mixed
+	// with output of steps.
+	var mu sync.Mutex
+	handleSignals(&mu, spec.Signals)
+
+	runSteps(spec.Steps, func(stream int, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		writeOutput(stream, data)
+	})
+
+	stdin.wait()
+
+	if spec.ExitSignal != 0 {
+		return exitBySignal(syscall.Signal(spec.ExitSignal))
+	}
+
+	return spec.Code
+}
+
+// runSteps runs steps of a stub and writes output by write.
+func runSteps(steps []stubStep, write func(stream int, data []byte)) {
+	for _, step := range steps {
+		switch {
+		case step.Hang:
+			time.Sleep(math.MaxInt64)
+		case step.Delay > 0:
+			time.Sleep(step.Delay)
+		default:
+			write(step.Stream, step.Data)
+		}
+	}
+}
+
+func writeOutput(stream int, data []byte) {
+	if stream == streamStderr {
+		_, _ = Stderr.Write(data)
+	} else {
+		_, _ = Stdout.Write(data)
+	}
+}
+
+// handleSignals installs signal handlers of a stub. A handler
+// holds mu to stop output of steps, writes its own output and
+// exits the helper process.
+func handleSignals(mu *sync.Mutex, handlers []stubSignal) {
+	if len(handlers) == 0 {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	for _, h := range handlers {
+		signal.Notify(ch, syscall.Signal(h.Signal))
+	}
+
+	go func() {
+		sig := <-ch
+		for _, h := range handlers {
+			if syscall.Signal(h.Signal) == sig {
+				mu.Lock()
+				runSteps(h.Steps, writeOutput)
+				os.Exit(h.Code)
+			}
+		}
+	}()
+}
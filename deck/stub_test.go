@@ -0,0 +1,287 @@
+package deck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Stub_ArgsMatcher(t *testing.T) {
+	at := assert.New(t)
+
+	at.True(AnyArgs(nil))
+	at.True(Args("status", "-s")([]string{"status", "-s"}))
+	at.False(Args("status")([]string{"status", "-s"}))
+	at.False(Args("status", "-b")([]string{"status", "-s"}))
+	at.True(ArgsPrefix("remote")([]string{"remote", "add"}))
+	at.False(ArgsPrefix("remote", "add")([]string{"remote"}))
+	at.True(ArgsRegexp(`^log -n \d+$`)([]string{"log", "-n", "3"}))
+	at.False(ArgsRegexp(`^log$`)([]string{"log", "-n", "3"}))
+}
+
+func Test_Deck_Stub_OnCommand(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("git", Args("status")).Stdout("clean")
+	OnCommand("git", ArgsPrefix("push")).Stdout("pushing\n").Stderr("rejected").Exit(3)
+	OnCommand("git", AnyArgs).Stdout("fallback")
+
+	t.Run("stdout", func(t *testing.T) {
+		b, err := ExecCommand("git", "status").Output()
+		at.Nil(err)
+		at.Equal("clean", string(b))
+	})
+
+	t.Run("stderr and exit code", func(t *testing.T) {
+		b, err := ExecCommand("git", "push", "origin").CombinedOutput()
+		at.Equal("pushing\nrejected", string(b))
+
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		at.Equal(3, exitErr.ExitCode())
+	})
+
+	t.Run("first match wins", func(t *testing.T) {
+		b, err := ExecCommand("git", "log").Output()
+		at.Nil(err)
+		at.Equal("fallback", string(b))
+	})
+
+	t.Run("fall back to helper", func(t *testing.T) {
+		b, err := ExecCommand("hg", "status").CombinedOutput()
+		at.Nil(err)
+		at.Equal("[hg status]", string(b))
+	})
+}
+
+func Test_Deck_Stub_Delay(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("sleep", AnyArgs).Delay(100 * time.Millisecond).Stdout("done")
+
+	start := time.Now()
+	b, err := ExecCommand("sleep").Output()
+	at.Nil(err)
+	at.Equal("done", string(b))
+	at.True(time.Since(start) >= 100*time.Millisecond)
+}
+
+func Test_Deck_Stub_Stream(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("docker", Args("build")).Stream(
+		Chunk{Data: "Step 1/2\n"},
+		Chunk{Stderr: true, Data: "warning\n", Delay: 10 * time.Millisecond},
+		Chunk{Data: "Step 2/2\n"},
+	)
+	OnCommand("rsync", AnyArgs).StdoutLines(100*time.Millisecond, "10%", "100%").StderrLines(0, "done")
+
+	t.Run("interleaved", func(t *testing.T) {
+		b, err := ExecCommand("docker", "build").CombinedOutput()
+		at.Nil(err)
+		at.Equal("Step 1/2\nwarning\nStep 2/2\n", string(b))
+	})
+
+	t.Run("line by line", func(t *testing.T) {
+		cmd := ExecCommand("rsync", "--progress")
+		stdout, err := cmd.StdoutPipe()
+		at.Nil(err)
+		at.Nil(cmd.Start())
+
+		var (
+			lines []string
+			times []time.Time
+		)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+			times = append(times, time.Now())
+		}
+
+		at.Nil(cmd.Wait())
+		at.Equal([]string{"10%", "100%"}, lines)
+		at.True(times[1].Sub(times[0]) >= 90*time.Millisecond)
+	})
+}
+
+func Test_Deck_Stub_Hang(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("terraform", AnyArgs).Stdout("planning").Hang()
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		b, err := ExecCommandContext(ctx, "terraform", "plan").Output()
+		at.NotNil(err)
+		at.Equal(context.DeadlineExceeded, ctx.Err())
+		at.Equal("planning", string(b))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		cmd := ExecCommandContext(ctx, "terraform", "apply")
+		at.Nil(cmd.Start())
+
+		cancel()
+
+		err := cmd.Wait()
+		at.NotNil(err)
+		at.Equal(context.Canceled, ctx.Err())
+	})
+}
+
+func Test_Deck_Stub_StdinOpen(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("kubectl", AnyArgs).Stdout("applied")
+
+	cmd := ExecCommand("kubectl", "apply", "-f", "-")
+	stdin, err := cmd.StdinPipe()
+	at.Nil(err)
+	defer func() { _ = stdin.Close() }()
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	at.Nil(cmd.Start())
+
+	_, err = stdin.Write([]byte("kind: Pod"))
+	at.Nil(err)
+
+	at.Nil(cmd.Wait())
+	at.Equal("applied", out.String())
+
+	invs := Invocations()
+	if at.Len(invs, 1) {
+		at.Equal("kind: Pod", invs[0].Stdin)
+	}
+}
+
+func Test_Deck_Stub_Signal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not delivered on windows")
+	}
+
+	at := assert.New(t)
+
+	SetupCmd()
+	defer TeardownCmd()
+
+	OnCommand("server", AnyArgs).
+		Stdout("ready\n").
+		Hang().
+		OnSignal(syscall.SIGTERM, 3, Chunk{Data: "shutting down\n"}).
+		OnSignal(syscall.SIGINT, 0, Chunk{Stderr: true, Data: "interrupted\n"})
+	OnCommand("crash", AnyArgs).Stdout("crashing").ExitBySignal(syscall.SIGTERM)
+
+	run := func(sig syscall.Signal) (string, error) {
+		cmd := ExecCommand("server")
+		stdout, err := cmd.StdoutPipe()
+		at.Nil(err)
+		at.Nil(cmd.Start())
+
+		r := bufio.NewReader(stdout)
+		line, err := r.ReadString('\n')
+		at.Nil(err)
+		at.Equal("ready\n", line)
+
+		at.Nil(cmd.Process.Signal(sig))
+
+		rest, _ := r.ReadString(0)
+		return rest, cmd.Wait()
+	}
+
+	t.Run("handled", func(t *testing.T) {
+		out, err := run(syscall.SIGTERM)
+		at.Equal("shutting down\n", out)
+
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		at.Equal(3, exitErr.ExitCode())
+	})
+
+	t.Run("handled with stderr", func(t *testing.T) {
+		cmd := ExecCommand("server")
+		stdout, err := cmd.StdoutPipe()
+		at.Nil(err)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		at.Nil(cmd.Start())
+
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		at.Nil(err)
+		at.Equal("ready\n", line)
+
+		at.Nil(cmd.Process.Signal(syscall.SIGINT))
+		at.Nil(cmd.Wait())
+		at.Equal("interrupted\n", stderr.String())
+	})
+
+	t.Run("not handled", func(t *testing.T) {
+		_, err := run(syscall.SIGHUP)
+
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		status := exitErr.Sys().(syscall.WaitStatus)
+		at.True(status.Signaled())
+		at.Equal(syscall.SIGHUP, status.Signal())
+	})
+
+	t.Run("exit by signal", func(t *testing.T) {
+		b, err := ExecCommand("crash").Output()
+		at.Equal("crashing", string(b))
+
+		exitErr, ok := err.(*exec.ExitError)
+		at.True(ok)
+		status := exitErr.Sys().(syscall.WaitStatus)
+		at.True(status.Signaled())
+		at.Equal(syscall.SIGTERM, status.Signal())
+	})
+}
+
+func Test_Deck_Stub_TeardownCmd(t *testing.T) {
+	at := assert.New(t)
+
+	SetupCmd()
+	OnCommand("git", AnyArgs).Stdout("stub")
+	TeardownCmd()
+
+	at.Nil(defaultCommander.findStub("git", nil))
+	at.Equal("", defaultCommander.dir)
+	at.Nil(Invocations())
+}
+
+func Test_Deck_Stub_ServeStub(t *testing.T) {
+	at := assert.New(t)
+
+	RedirectStderr()
+	code := serveStub("not-exist")
+	output := DumpStderr()
+
+	at.Equal(1, code)
+	at.Contains(output, "deck: ")
+}
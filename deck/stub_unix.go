@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package deck
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// exitBySignal kills the helper process with sig. It returns
+// 1 if the process is still alive, e.g. sig is ignored.
+func exitBySignal(sig syscall.Signal) int {
+	signal.Reset(sig)
+
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		_, _ = Stderr.WriteString("deck: " + err.Error())
+		return 1
+	}
+
+	time.Sleep(time.Second)
+
+	_, _ = Stderr.WriteString("deck: stub is not killed by " + sig.String())
+	return 1
+}
@@ -0,0 +1,9 @@
+package deck
+
+import "syscall"
+
+// exitBySignal is not supported on Windows.
+func exitBySignal(sig syscall.Signal) int {
+	_, _ = Stderr.WriteString("deck: exiting by " + sig.String() + " is not supported on windows")
+	return 1
+}
@@ -0,0 +1,100 @@
+package deck
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// subprocessMarker follows "--" in args of a subprocess started
+// by RunInSubprocess, and it is followed by the function name.
+const subprocessMarker = "deck-subprocess"
+
+// SubprocessResult is how a function run by RunInSubprocess ended.
+type SubprocessResult struct {
+	// Code is the exit code of the subprocess
+	Code int
+	// Stdout is the output to stdout
+	Stdout string
+	// Stderr is the output to stderr
+	Stderr string
+}
+
+// RunInSubprocess runs fn in a subprocess, so that fn can call
+// os.Exit or log.Fatal for real. The test binary is run again with
+// only the current test, which runs fn when it calls RunInSubprocess
+// with the same name and exits with code 0 if fn returns. Code of
+// the test before RunInSubprocess also runs in the subprocess, and
+// name should be unique in the test.
+func RunInSubprocess(t *testing.T, name string, fn func()) SubprocessResult {
+	t.Helper()
+	return runInSubprocess(t, name, fn)
+}
+
+// RunInSubprocess is like the package level RunInSubprocess, but
+// the subprocess runs the test of the Deck, and failures to start
+// it are reported to that test.
+func (d *Deck) RunInSubprocess(name string, fn func()) SubprocessResult {
+	d.t.Helper()
+	return runInSubprocess(d.t, name, fn)
+}
+
+func runInSubprocess(t testing.TB, name string, fn func()) SubprocessResult {
+	t.Helper()
+
+	if target, ok := subprocessName(os.Args); ok {
+		if target == name {
+			fn()
+			os.Exit(0)
+		}
+		return SubprocessResult{}
+	}
+
+	// #nosec G204 the test binary is run again
+	cmd := exec.Command(helperBinary(), "-test.run="+testRunPattern(t.Name()),
+		"--", subprocessMarker, name)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	r := SubprocessResult{}
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatal(err)
+			return r
+		}
+		r.Code = exitErr.ExitCode()
+	}
+	r.Stdout, r.Stderr = stdout.String(), stderr.String()
+
+	return r
+}
+
+// subprocessName gets name of the function which should run if
+// the process is started by RunInSubprocess.
+func subprocessName(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			if len(args) > i+2 && args[i+1] == subprocessMarker {
+				return args[i+2], true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// testRunPattern gets a -test.run pattern which only matches
+// the test named name.
+func testRunPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+	return strings.Join(parts, "/")
+}
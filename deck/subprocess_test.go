@@ -0,0 +1,61 @@
+package deck
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Subprocess_RunInSubprocess(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("os exit", func(t *testing.T) {
+		r := RunInSubprocess(t, "exit", func() {
+			fmt.Print("exiting")
+			os.Exit(3)
+		})
+		at.Equal(3, r.Code)
+		at.Equal("exiting", r.Stdout)
+	})
+
+	t.Run("log fatal", func(t *testing.T) {
+		r := RunInSubprocess(t, "fatal", func() {
+			log.Fatal("fatal error")
+		})
+		at.Equal(1, r.Code)
+		at.Contains(r.Stderr, "fatal error")
+	})
+
+	t.Run("return and panic", func(t *testing.T) {
+		r := RunInSubprocess(t, "return", func() {
+			fmt.Fprint(os.Stderr, "returning")
+		})
+		at.Equal(0, r.Code)
+		at.Equal("returning", r.Stderr)
+
+		r = RunInSubprocess(t, "panic", func() { panic("boom") })
+		at.Equal(2, r.Code)
+		at.Contains(r.Stderr, "panic: boom")
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		r := New(t).RunInSubprocess("exit", func() { os.Exit(4) })
+		at.Equal(4, r.Code)
+	})
+}
+
+func Test_Deck_Subprocess_Helpers(t *testing.T) {
+	at := assert.New(t)
+
+	name, ok := subprocessName([]string{"bin", "--", subprocessMarker, "fn"})
+	at.True(ok)
+	at.Equal("fn", name)
+
+	_, ok = subprocessName([]string{"bin", "--", helperMarker, "base"})
+	at.False(ok)
+
+	at.Equal(`^Test_A$/^sub\.case$`, testRunPattern("Test_A/sub.case"))
+}
@@ -0,0 +1,203 @@
+package deck
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// WriteTree writes files of a txtar archive, usually under
+// testdata, into dir. Parent directories are created as needed.
+// See AssertTree for the format of the archive.
+func WriteTree(dir, archive string) error {
+	_, files, err := readTxtar(archive)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		file := filepath.Join(dir, filepath.FromSlash(f.name))
+		if err = os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(file, f.data, f.mode); err != nil {
+			return err
+		}
+		// the mode given to WriteFile is masked by umask.
+		if err = os.Chmod(file, f.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetupTree writes files of a txtar archive into a temporary
+// directory, which is removed when the test ends, and gets the
+// directory.
+func (d *Deck) SetupTree(archive string) string {
+	d.t.Helper()
+
+	dir, err := ioutil.TempDir("", "deck-tree")
+	if err != nil {
+		d.t.Fatal(err)
+		return ""
+	}
+	d.t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	if err = WriteTree(dir, archive); err != nil {
+		d.t.Fatal(err)
+	}
+
+	return dir
+}
+
+// AssertTree asserts files under dir match files of a txtar
+// archive exactly, and shows missing and extra files, different
+// modes and diffs of contents on mismatch. The header of a file can
+// end with an octal mode, like "-- bin/run.sh 0755 --", otherwise
+// the mode is 0644. Modes are not compared on Windows. Empty
+// directories are ignored, and so is a missing newline at the end
+// of a file. The archive is written with files under dir instead
+// when the test runs with -deck.update.
+func AssertTree(t *testing.T, dir, archive string) bool {
+	t.Helper()
+	return assertTree(t, dir, archive)
+}
+
+// AssertTree is like the package level AssertTree, but failures
+// are reported to the test of the Deck.
+func (d *Deck) AssertTree(dir, archive string) bool {
+	d.t.Helper()
+	return assertTree(d.t, dir, archive)
+}
+
+func assertTree(t assert.TestingT, dir, archive string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	got, err := readTree(dir)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("deck: failed to read tree: %s", err))
+	}
+
+	if shouldUpdate() {
+		// the comment of an existing archive is kept.
+		comment, _, _ := readTxtar(archive)
+		if err = writeGolden(fixturePath(archive), string(formatTxtar(comment, got))); err != nil {
+			return assert.Fail(t, fmt.Sprintf("deck: failed to update tree archive: %s", err))
+		}
+		return true
+	}
+
+	_, want, err := readTxtar(archive)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("deck: failed to read tree archive: %s", err))
+	}
+
+	if diff := treeDiff(want, got); diff != "" {
+		return assert.Fail(t, fmt.Sprintf("deck: tree %s does not match %s\n%s", dir, archive, diff))
+	}
+
+	return true
+}
+
+func readTxtar(archive string) (comment []byte, files []txtarFile, err error) {
+	b, err := ioutil.ReadFile(filepath.Clean(fixturePath(archive)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comment, files = parseTxtar(b)
+	return comment, files, nil
+}
+
+// readTree gets files under dir sorted by name.
+func readTree(dir string) ([]txtarFile, error) {
+	var files []txtarFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, txtarFile{
+			name: filepath.ToSlash(name),
+			mode: info.Mode().Perm(),
+			data: data,
+		})
+
+		return nil
+	})
+
+	return files, err
+}
+
+func treeDiff(want, got []txtarFile) string {
+	wantFiles := make(map[string]txtarFile, len(want))
+	for _, f := range want {
+		wantFiles[f.name] = f
+	}
+	gotFiles := make(map[string]txtarFile, len(got))
+	for _, f := range got {
+		gotFiles[f.name] = f
+	}
+
+	var names []string
+	for name := range wantFiles {
+		names = append(names, name)
+	}
+	for name := range gotFiles {
+		if _, ok := wantFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		w, inWant := wantFiles[name]
+		g, inGot := gotFiles[name]
+
+		switch {
+		case !inGot:
+			b.WriteString("missing file: " + name + "\n")
+		case !inWant:
+			b.WriteString("extra file: " + name + "\n")
+		default:
+			if runtime.GOOS != "windows" && w.mode != g.mode {
+				_, _ = fmt.Fprintf(&b, "mode of %s: want %04o, got %04o\n", name, w.mode, g.mode)
+			}
+			if !bytes.Equal(withNewline(w.data), withNewline(g.data)) {
+				b.WriteString(goldenDiff(name, string(w.data), string(g.data)) + "\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func withNewline(data []byte) []byte {
+	if len(data) > 0 && !bytes.HasSuffix(data, newline) {
+		return append(data[:len(data):len(data)], '\n')
+	}
+	return data
+}
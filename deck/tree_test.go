@@ -0,0 +1,91 @@
+package deck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Tree(t *testing.T) {
+	at := assert.New(t)
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	in := filepath.Join("testdata", "tree", "in.txtar")
+	out := filepath.Join("testdata", "tree", "out.txtar")
+
+	generate := func(dir string) {
+		at.Nil(os.MkdirAll(filepath.Join(dir, "user"), 0750))
+		at.Nil(ioutil.WriteFile(filepath.Join(dir, "user", "user.go"),
+			[]byte("package user\n\ntype User struct{}\n"), 0600))
+		at.Nil(os.Chmod(filepath.Join(dir, "user", "user.go"), 0644))
+	}
+
+	t.Run("match", func(t *testing.T) {
+		d := New(t)
+		dir := d.SetupTree(in)
+
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(filepath.Join(dir, "scripts", "build.sh"))
+			at.Nil(err)
+			at.Equal(os.FileMode(0755), info.Mode().Perm())
+		}
+
+		generate(dir)
+		at.True(d.AssertTree(dir, out))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		dir := New(t).SetupTree(in)
+		generate(dir)
+		at.Nil(ioutil.WriteFile(filepath.Join(dir, "api.yaml"), []byte("name: post\n"), 0644))
+		at.Nil(ioutil.WriteFile(filepath.Join(dir, "extra.txt"), nil, 0644))
+		at.Nil(os.Remove(filepath.Join(dir, "user", "user.go")))
+		at.Nil(os.Chmod(filepath.Join(dir, "scripts", "build.sh"), 0644))
+
+		tb := &fakeTB{}
+		at.False(assertTree(tb, dir, out))
+		at.Contains(tb.fatal, "-name: user\n")
+		at.Contains(tb.fatal, "+name: post\n")
+		at.Contains(tb.fatal, "extra file: extra.txt\n")
+		at.Contains(tb.fatal, "missing file: user/user.go\n")
+		if runtime.GOOS != "windows" {
+			at.Contains(tb.fatal, "mode of scripts/build.sh: want 0755, got 0644\n")
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		d := New(t)
+		dir := d.SetupTree(in)
+		archive := filepath.Join(d.SetupTree(in), "out.txtar")
+
+		*updateFlag = true
+		defer func() { *updateFlag = false }()
+
+		generate(dir)
+		at.Nil(ioutil.WriteFile(archive, []byte("generated\n"), 0600))
+		at.True(AssertTree(t, dir, archive))
+
+		*updateFlag = false
+		at.True(AssertTree(t, dir, archive))
+
+		b, err := ioutil.ReadFile(archive)
+		at.Nil(err)
+		at.True(strings.HasPrefix(string(b), "generated\n-- api.yaml --\n"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		at.NotNil(WriteTree(os.TempDir(), "not-exist.txtar"))
+
+		tb := &fakeTB{}
+		at.False(assertTree(tb, "not-exist", out))
+		at.Contains(tb.fatal, "deck: failed to read tree")
+	})
+}
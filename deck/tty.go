@@ -0,0 +1,148 @@
+package deck
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// TTYOutput is everything printed to Stdout while a function runs
+// in CaptureTTY.
+type TTYOutput struct {
+	// Raw is the output read from the terminal as it is, with
+	// escape sequences and newlines translated to "\r\n"
+	Raw string
+}
+
+// Text gets Raw rendered like a terminal shows it, line by line:
+// "\r\n" is translated back to "\n", a carriage return moves back
+// to the start of the line, so later text overwrites it, erasing
+// the line by ESC[K or ESC[2K is applied, and other escape
+// sequences are stripped.
+func (o TTYOutput) Text() string {
+	lines := strings.Split(strings.Replace(o.Raw, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		lines[i] = renderLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderLine renders a line of terminal output. Erased cells are
+// kept as 0 until the line is done, so they don't show up as
+// trailing spaces.
+func renderLine(line string) string {
+	var cells []rune
+	col := 0
+
+	for line != "" {
+		if loc := ansiPrefixRegexp.FindStringIndex(line); loc != nil {
+			switch line[:loc[1]] {
+			case "\x1b[K", "\x1b[0K":
+				cells = cells[:col]
+			case "\x1b[2K":
+				for i := range cells {
+					cells[i] = 0
+				}
+			}
+			line = line[loc[1]:]
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(line)
+		line = line[size:]
+
+		if r == '\r' {
+			col = 0
+			continue
+		}
+
+		if col < len(cells) {
+			cells[col] = r
+		} else {
+			cells = append(cells, r)
+		}
+		col++
+	}
+
+	for len(cells) > 0 && cells[len(cells)-1] == 0 {
+		cells = cells[:len(cells)-1]
+	}
+	for i, r := range cells {
+		if r == 0 {
+			cells[i] = ' '
+		}
+	}
+
+	return string(cells)
+}
+
+// ansiPattern matches CSI, OSC and other escape sequences.
+const ansiPattern = `\x1b(\[[0-9:;<=>?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[0-Z\\^-~])`
+
+var (
+	ansiRegexp       = regexp.MustCompile(ansiPattern)
+	ansiPrefixRegexp = regexp.MustCompile(`^` + ansiPattern)
+)
+
+// StripANSI removes ANSI escape sequences, like colors and cursor
+// movements, from s.
+func StripANSI(s string) string {
+	return ansiRegexp.ReplaceAllString(s, "")
+}
+
+// CaptureTTY runs fn with Stdout mocked by a pseudo-terminal of
+// cols columns and rows rows, and gets what is printed to it. Code
+// which checks whether Stdout is a terminal, or its window size,
+// behaves like it runs in a terminal. It is only supported on Linux.
+func CaptureTTY(cols, rows int, fn func()) (TTYOutput, error) {
+	own(mockNameStdout)
+	defer disown(mockNameStdout)
+
+	return captureTTY(cols, rows, fn)
+}
+
+// CaptureTTY is like the package level CaptureTTY, but Stdout
+// stays claimed by the Deck after fn returns, so another Deck can't
+// mock it until the test ends.
+func (d *Deck) CaptureTTY(cols, rows int, fn func()) (TTYOutput, error) {
+	d.t.Helper()
+
+	if !d.claim(mockNameStdout, nil) {
+		return TTYOutput{}, nil
+	}
+
+	return captureTTY(cols, rows, fn)
+}
+
+func captureTTY(cols, rows int, fn func()) (o TTYOutput, err error) {
+	master, slave, err := openPty(cols, rows)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		// reading the master gets an error once the slave is closed.
+		_, _ = io.Copy(&buf, master)
+		close(done)
+	}()
+
+	old := Stdout
+	Stdout = slave
+
+	defer func() {
+		Stdout = old
+		_ = slave.Close()
+		<-done
+		_ = master.Close()
+
+		o.Raw = buf.String()
+	}()
+
+	fn()
+
+	return
+}
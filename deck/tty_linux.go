@@ -0,0 +1,44 @@
+package deck
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPty opens a pseudo-terminal of the window size.
+func openPty(cols, rows int) (master, slave *os.File, err error) {
+	if master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0); err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = master.Close()
+		}
+	}()
+
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		return nil, nil, err
+	}
+
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := "/dev/pts/" + strconv.Itoa(n)
+	if slave, err = os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0); err != nil {
+		return nil, nil, err
+	}
+
+	ws := &unix.Winsize{Col: uint16(cols), Row: uint16(rows)}
+	if err = unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, ws); err != nil {
+		_ = slave.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
@@ -0,0 +1,39 @@
+package deck
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func Test_Deck_TTY_CaptureTTY(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("terminal", func(t *testing.T) {
+		var cols, rows uint16
+		o, err := CaptureTTY(120, 40, func() {
+			ws, err := unix.IoctlGetWinsize(int(Stdout.Fd()), unix.TIOCGWINSZ)
+			at.Nil(err)
+			cols, rows = ws.Col, ws.Row
+
+			_, _ = fmt.Fprintln(Stdout, "\x1b[32mok\x1b[0m")
+			_, _ = fmt.Fprint(Stdout, "\x1b[2K\rdone")
+		})
+
+		at.Nil(err)
+		at.Equal(uint16(120), cols)
+		at.Equal(uint16(40), rows)
+		at.Equal("\x1b[32mok\x1b[0m\r\n\x1b[2K\rdone", o.Raw)
+		at.Equal("ok\ndone", o.Text())
+	})
+
+	t.Run("deck", func(t *testing.T) {
+		o, err := New(t).CaptureTTY(80, 24, func() { _, _ = fmt.Fprint(Stdout, "deck") })
+		at.Nil(err)
+		at.Equal("deck", o.Raw)
+
+		at.Panics(func() { RedirectStdout() })
+	})
+}
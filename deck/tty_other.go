@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package deck
+
+import (
+	"errors"
+	"os"
+)
+
+// openPty is only supported on Linux.
+func openPty(_, _ int) (master, slave *os.File, err error) {
+	return nil, nil, errors.New("deck: pseudo-terminals are only supported on linux")
+}
@@ -0,0 +1,33 @@
+package deck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_TTY_StripANSI(t *testing.T) {
+	at := assert.New(t)
+
+	at.Equal("red bold", StripANSI("\x1b[31mred\x1b[0m \x1b[1;4mbold\x1b[m"))
+	at.Equal("title", StripANSI("\x1b]0;window\x07title"))
+	at.Equal("up", StripANSI("\x1b[?25l\x1b[1Aup\x1b7\x1b8"))
+}
+
+func Test_Deck_TTY_Text(t *testing.T) {
+	at := assert.New(t)
+
+	for raw, text := range map[string]string{
+		"\x1b[32mok\x1b[0m\r\ndone": "ok\ndone",
+		"loading\rdone":             "doneing",
+		"loading\r\x1b[Kdone":       "done",
+		"loading\x1b[2K\rdone":      "done",
+		"- 1/3\r\\ 2/3\r| 3/3\r\n":  "| 3/3\n",
+		"\x1b[2K\r":                 "",
+		"ab\x1b[2Kcd":               "  cd",
+		"a\rb\r\nc":                 "b\nc",
+		"\u4e2d\u6587\rx":           "x\u6587",
+	} {
+		at.Equal(text, TTYOutput{Raw: raw}.Text(), "%q", raw)
+	}
+}
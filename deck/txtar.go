@@ -0,0 +1,110 @@
+package deck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// txtarFile is a file in a txtar archive. Besides the standard
+// format, the header of a file can end with an octal mode, like
+// "-- bin/run.sh 0755 --", which is specific to deck. A header
+// whose last field is not a mode is the name as it is, so names
+// can contain spaces.
+type txtarFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+// defaultTxtarMode is the mode of files whose header has none.
+const defaultTxtarMode os.FileMode = 0644
+
+var (
+	txtarMarker    = []byte("-- ")
+	txtarMarkerEnd = []byte(" --")
+	newline        = []byte("\n")
+)
+
+// parseTxtar parses the comment before the first file and
+// files of a txtar archive.
+func parseTxtar(data []byte) (comment []byte, files []txtarFile) {
+	var current *txtarFile
+
+	data = bytes.Replace(data, []byte("\r\n"), newline, -1)
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			data = nil
+		}
+
+		if f, ok := parseTxtarHeader(line); ok {
+			files = append(files, f)
+			current = &files[len(files)-1]
+			continue
+		}
+
+		if current != nil {
+			current.data = append(current.data, line...)
+		} else {
+			comment = append(comment, line...)
+		}
+	}
+
+	return comment, files
+}
+
+// txtarModeRegexp matches a mode at the end of a header.
+var txtarModeRegexp = regexp.MustCompile(`^(.+?)\s+(0?[0-7]{3})$`)
+
+func parseTxtarHeader(line []byte) (f txtarFile, ok bool) {
+	line = bytes.TrimSuffix(line, newline)
+	if !bytes.HasPrefix(line, txtarMarker) || !bytes.HasSuffix(line, txtarMarkerEnd) ||
+		len(line) < len(txtarMarker)+len(txtarMarkerEnd) {
+		return
+	}
+
+	f.name = strings.TrimSpace(string(line[len(txtarMarker) : len(line)-len(txtarMarkerEnd)]))
+	if f.name == "" {
+		return
+	}
+
+	f.mode = defaultTxtarMode
+	if m := txtarModeRegexp.FindStringSubmatch(f.name); m != nil {
+		mode, _ := strconv.ParseUint(m[2], 8, 32)
+		f.name, f.mode = m[1], os.FileMode(mode)
+	}
+
+	return f, true
+}
+
+// formatTxtar formats a txtar archive. The comment and
+// every file end with a newline.
+func formatTxtar(comment []byte, files []txtarFile) []byte {
+	var b bytes.Buffer
+	b.Write(comment)
+	if len(comment) > 0 && !bytes.HasSuffix(comment, newline) {
+		b.WriteByte('\n')
+	}
+
+	for _, f := range files {
+		b.WriteString("-- " + f.name)
+		// a name ending with a mode-like field needs the mode
+		// even if it is the default one.
+		if f.mode != defaultTxtarMode || txtarModeRegexp.MatchString(f.name) {
+			_, _ = fmt.Fprintf(&b, " %04o", f.mode)
+		}
+		b.WriteString(" --\n")
+
+		b.Write(f.data)
+		if len(f.data) > 0 && !bytes.HasSuffix(f.data, newline) {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,46 @@
+package deck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Txtar(t *testing.T) {
+	at := assert.New(t)
+
+	t.Run("parse", func(t *testing.T) {
+		comment, files := parseTxtar([]byte("comment\r\n-- a.txt --\r\na\n-- b/c.sh 0755 --\nc\n-- empty --\n-- d.txt --\nno newline"))
+		at.Equal("comment\n", string(comment))
+		at.Equal([]txtarFile{
+			{name: "a.txt", mode: 0644, data: []byte("a\n")},
+			{name: "b/c.sh", mode: 0755, data: []byte("c\n")},
+			{name: "empty", mode: 0644},
+			{name: "d.txt", mode: 0644, data: []byte("no newline")},
+		}, files)
+	})
+
+	t.Run("names with spaces", func(t *testing.T) {
+		_, files := parseTxtar([]byte("-- my notes.txt --\n-- a.txt 0799 --\n-- bin/my tool 755 --\n--  --\n-- b.txt 0644 --\n"))
+		at.Equal([]txtarFile{
+			{name: "my notes.txt", mode: 0644},
+			{name: "a.txt 0799", mode: 0644},
+			{name: "bin/my tool", mode: 0755, data: []byte("--  --\n")},
+			{name: "b.txt", mode: 0644},
+		}, files)
+	})
+
+	t.Run("format", func(t *testing.T) {
+		at.Equal("note\n-- a.txt --\na\n-- b.sh 0755 --\nb\n-- empty --\n", string(formatTxtar([]byte("note"), []txtarFile{
+			{name: "a.txt", mode: 0644, data: []byte("a\n")},
+			{name: "b.sh", mode: 0755, data: []byte("b")},
+			{name: "empty", mode: 0644},
+		})))
+
+		archive := formatTxtar(nil, []txtarFile{{name: "notes 0644", mode: 0644}, {name: "my notes", mode: 0644}})
+		at.Equal("-- notes 0644 0644 --\n-- my notes --\n", string(archive))
+
+		_, files := parseTxtar(archive)
+		at.Equal([]txtarFile{{name: "notes 0644", mode: 0644}, {name: "my notes", mode: 0644}}, files)
+	})
+}
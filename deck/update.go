@@ -0,0 +1,39 @@
+package deck
+
+import (
+	"flag"
+	"strconv"
+)
+
+// updateFlag makes deck update files it records under testdata,
+// like command transcripts. It is only registered in test
+// binaries, e.g. go test -args -deck.update, and is false in
+// other binaries.
+//
+// deck doesn't define -update itself, since its init runs before
+// the package under test, which would panic when it defines its
+// own -update, as many packages do. Such a flag is honored by
+// shouldUpdate instead.
+var updateFlag = new(bool)
+
+func init() {
+	if isTestBinary() {
+		flag.BoolVar(updateFlag, "deck.update", false, "update files recorded by deck under testdata")
+	}
+}
+
+// shouldUpdate reports whether recorded files should be updated.
+// Besides -deck.update, an -update flag defined by the package
+// under test is honored too.
+func shouldUpdate() bool {
+	if *updateFlag {
+		return true
+	}
+
+	if f := flag.Lookup("update"); f != nil {
+		update, _ := strconv.ParseBool(f.Value.String())
+		return update
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package deck
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deck_Update_ShouldUpdate(t *testing.T) {
+	at := assert.New(t)
+
+	update := *updateFlag
+	*updateFlag = false
+	defer func() { *updateFlag = update }()
+
+	at.NotNil(flag.Lookup("deck.update"))
+	at.False(shouldUpdate())
+
+	*updateFlag = true
+	at.True(shouldUpdate())
+	*updateFlag = false
+
+	// an -update flag defined by the package under test.
+	if flag.Lookup("update") == nil {
+		_ = flag.Bool("update", false, "update golden files")
+	}
+	at.False(shouldUpdate())
+
+	at.Nil(flag.Set("update", "true"))
+	defer func() { _ = flag.Set("update", "false") }()
+	at.True(shouldUpdate())
+}
@@ -7,12 +7,14 @@ require (
 	github.com/go-dawn/dawn v0.4.3
 	github.com/gofiber/fiber/v2 v2.5.0
 	github.com/klauspost/compress v1.11.12 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
 	github.com/valyala/bytebufferpool v1.0.0
 	github.com/valyala/fasthttp v1.22.0 // indirect
 	github.com/valyala/fastrand v1.0.0
-	golang.org/x/sys v0.0.0-20210309040221-94ec62e08169 // indirect
+	golang.org/x/sys v0.0.0-20210309040221-94ec62e08169
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.3
 )